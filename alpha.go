@@ -0,0 +1,56 @@
+package gojxl
+
+// AlphaMode chooses whether color samples are premultiplied by alpha.
+type AlphaMode int
+
+const (
+	// AlphaAuto keeps whatever the image declares.
+	AlphaAuto AlphaMode = iota
+	// AlphaStraight means color samples are not premultiplied.
+	AlphaStraight
+	// AlphaPremultiplied means color samples are premultiplied by alpha.
+	AlphaPremultiplied
+)
+
+// resolve applies the mode to what an image declares.
+func (m AlphaMode) resolve(premult bool) bool {
+	switch m {
+	case AlphaStraight:
+		return false
+	case AlphaPremultiplied:
+		return true
+	}
+	return premult
+}
+
+// mustPremultiply reports whether libjxl hands out straight alpha that
+// DecoderOptions.Alpha asks to be premultiplied.
+func (d *JxlDecoder) mustPremultiply(info JxlInfo) bool {
+	return d.opts.Alpha == AlphaPremultiplied && info.Alpha != 0 && info.Channels != 1 && !info.FileAlphaPremult
+}
+
+// premultiply multiplies the color samples of straight RGBA rows by their
+// alpha. libjxl can only undo premultiplication, not apply it.
+func premultiply(buf []byte, w, h, stride int, depth16 bool) {
+	for y := 0; y < h; y++ {
+		row := buf[y*stride:]
+		if depth16 {
+			for x := 0; x < w; x++ {
+				p := row[8*x : 8*x+8]
+				a := uint32(p[6])<<8 | uint32(p[7])
+				for c := 0; c < 6; c += 2 {
+					v := (uint32(p[c])<<8 | uint32(p[c+1])) * a / 0xffff
+					p[c], p[c+1] = byte(v>>8), byte(v)
+				}
+			}
+		} else {
+			for x := 0; x < w; x++ {
+				p := row[4*x : 4*x+4]
+				a := uint32(p[3])
+				for c := 0; c < 3; c++ {
+					p[c] = byte((uint32(p[c])*a + 127) / 255)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// translucent has alpha between 128 and 255, where premultiplying loses
+// at most one bit of precision.
+func translucent() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(8 * x), uint8(10 * y), uint8(x * y), uint8(128 + 5*x)})
+		}
+	}
+	return img
+}
+
+func closeColors(a, b color.Color, tol uint32) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	near := func(x, y uint32) bool {
+		if x > y {
+			x, y = y, x
+		}
+		return y-x <= tol*0x101
+	}
+	return near(ar, br) && near(ag, bg) && near(ab, bb) && near(aa, ba)
+}
+
+func decodeAlpha(t *testing.T, data []byte, mode jxl.AlphaMode) image.Image {
+	t.Helper()
+	img, err := jxl.DecodeWithOptions(bytes.NewReader(data), &jxl.DecoderOptions{Alpha: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestDecodeAlphaMode(t *testing.T) {
+	src := translucent()
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, src, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decodeAlpha(t, buf.Bytes(), jxl.AlphaAuto).(*image.NRGBA); !ok {
+		t.Error("expected *image.NRGBA by default")
+	}
+	img, ok := decodeAlpha(t, buf.Bytes(), jxl.AlphaPremultiplied).(*image.RGBA)
+	if !ok {
+		t.Fatal("expected *image.RGBA for premultiplied output")
+	}
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			if !closeColors(img.At(x, y), src.At(x, y), 1) {
+				t.Fatalf("pixel %d,%d: got %v, want %v", x, y, img.At(x, y), src.At(x, y))
+			}
+		}
+	}
+}
+
+func TestDecodeUnpremultiply(t *testing.T) {
+	src := image.NewRGBA(translucent().Rect)
+	copy(src.Pix, translucent().Pix)
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, src, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decodeAlpha(t, buf.Bytes(), jxl.AlphaAuto).(*image.RGBA); !ok {
+		t.Error("expected *image.RGBA by default")
+	}
+	img, ok := decodeAlpha(t, buf.Bytes(), jxl.AlphaStraight).(*image.NRGBA)
+	if !ok {
+		t.Fatal("expected *image.NRGBA for straight output")
+	}
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			if !closeColors(img.At(x, y), src.At(x, y), 2) {
+				t.Fatalf("pixel %d,%d: got %v, want %v", x, y, img.At(x, y), src.At(x, y))
+			}
+		}
+	}
+}
+
+func TestEncodeAlphaMode(t *testing.T) {
+	src := translucent()
+	buf := new(bytes.Buffer)
+	e, err := jxl.NewEncoder(buf, &jxl.EncoderOptions{Alpha: jxl.AlphaPremultiplied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy()
+	if !e.SetInfo(32, 24, color.NRGBAModel, 0) {
+		t.Fatal(e.Err())
+	}
+	err = e.Write(src.Pix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jxl.DecodeConfig(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ColorModel != color.RGBAModel {
+		t.Error("expected a premultiplied image, got", cfg.ColorModel)
+	}
+}
@@ -0,0 +1,101 @@
+package gojxl
+
+import (
+	"image"
+	"io"
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <stdlib.h>
+import "C"
+
+// NewJxlDecoderFromBytes decodes b in place. The whole of b is handed to
+// libjxl at once, so b must not be modified until the decoder is destroyed
+// or reset.
+func NewJxlDecoderFromBytes(b []byte, opts *DecoderOptions) (*JxlDecoder, error) {
+	d, err := newDecoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.whole = true
+	d.in = b
+	return d, nil
+}
+
+// NewJxlDecoderFromReaderAt copies size bytes of r into C memory up front and
+// hands them to libjxl at once, instead of streaming them through a small
+// buffer. Unlike NewJxlDecoderFromBytes, it holds a copy of the whole input,
+// so size is checked against Limits.MaxInputBytes before anything is read.
+func NewJxlDecoderFromReaderAt(r io.ReaderAt, size int64, opts *DecoderOptions) (*JxlDecoder, error) {
+	d, err := newDecoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.whole = true
+	if err = checkLimit("input bytes", size, d.opts.Limits.MaxInputBytes); err != nil {
+		err = d.failed(err)
+		d.Destroy()
+		return nil, err
+	}
+	if size > 0 {
+		d.cin = C.malloc(C.size_t(size))
+		if d.cin == nil {
+			d.Destroy()
+			return nil, DecodeAllocError
+		}
+		d.in = unsafe.Slice((*byte)(d.cin), size)
+		n, err := r.ReadAt(d.in, 0)
+		if err != nil && err != io.EOF {
+			d.Destroy()
+			return nil, err
+		}
+		d.in = d.in[:n]
+	}
+	return d, nil
+}
+
+// setWholeInput gives libjxl the entire input and closes it. There is never
+// more to give, so a second call means the input is truncated.
+func (d *JxlDecoder) setWholeInput() error {
+	if len(d.in) == 0 {
+		return d.failed(io.EOF)
+	}
+	if d.inLen != 0 {
+		return d.failed(io.ErrUnexpectedEOF)
+	}
+	d.inLen = len(d.in)
+	d.consumed = int64(d.inLen)
+	if err := checkLimit("input bytes", d.consumed, d.opts.Limits.MaxInputBytes); err != nil {
+		d.err = d.failed(err)
+		return d.err
+	}
+	if d.cin == nil {
+		d.inPinner.Pin(&d.in[0])
+	}
+	status := C.JxlDecoderSetInput(d.decoder, (*C.uchar)(unsafe.Pointer(&d.in[0])), C.size_t(d.inLen))
+	if status != C.JXL_DEC_SUCCESS {
+		return d.failed(DecodeInputError)
+	}
+	C.JxlDecoderCloseInput(d.decoder)
+	return nil
+}
+
+func (d *JxlDecoder) freeInput() {
+	d.inPinner.Unpin()
+	if d.cin != nil {
+		C.free(d.cin)
+		d.cin = nil
+	}
+	d.in = nil
+	d.whole = false
+}
+
+func DecodeBytes(b []byte) (image.Image, error) {
+	d, err := NewJxlDecoderFromBytes(b, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Destroy()
+	return d.image()
+}
@@ -0,0 +1,128 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/devedge/imagehash"
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestDecodeBytes(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jxl.DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := imagehash.DhashHorizontal(img, 8)
+	h := binary.BigEndian.Uint64(h2)
+	if h != DecodeSingleImgHash {
+		t.Error("crc does not match", DecodeSingleImgHash, h)
+	}
+}
+
+func TestDecodeBytesTruncated(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jxl.DecodeBytes(data[:len(data)/2])
+	var decErr *jxl.DecoderError
+	if !errors.As(err, &decErr) {
+		t.Fatal("expected *DecoderError, got", err)
+	}
+	_, err = jxl.DecodeBytes(nil)
+	if !errors.Is(err, io.EOF) {
+		t.Error("expected io.EOF, got", err)
+	}
+}
+
+func TestDecoderFromReaderAt(t *testing.T) {
+	frames := readVideoFrames(t)
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jxl.NewJxlDecoderFromReaderAt(f, fi.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	for i, want := range frames {
+		got, err := d.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("frame %d differs from streaming decode", i)
+		}
+	}
+	got, err := d.Read()
+	if got != nil || err != nil {
+		t.Error("expected end of stream, got", err)
+	}
+	err = d.SeekFrame(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, frames[1]) {
+		t.Error("frame 1 differs after seeking back")
+	}
+}
+
+func benchmarkDecode(b *testing.B, decode func(data []byte) error) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStream(b *testing.B) {
+	benchmarkDecode(b, func(data []byte) error {
+		_, err := jxl.Decode(bytes.NewReader(data))
+		return err
+	})
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	benchmarkDecode(b, func(data []byte) error {
+		_, err := jxl.DecodeBytes(data)
+		return err
+	})
+}
+
+func BenchmarkDecodeReaderAt(b *testing.B) {
+	benchmarkDecode(b, func(data []byte) error {
+		d, err := jxl.NewJxlDecoderFromReaderAt(bytes.NewReader(data), int64(len(data)), nil)
+		if err != nil {
+			return err
+		}
+		defer d.Destroy()
+		_, err = d.Read()
+		return err
+	})
+}
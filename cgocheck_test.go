@@ -0,0 +1,26 @@
+package gojxl_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCgocheck(t *testing.T) {
+	if os.Getenv("GOJXL_CGOCHECK") != "" {
+		t.Skip("already running under cgocheck2")
+	}
+	if testing.Short() {
+		t.Skip("skipping cgocheck2 rebuild in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	cmd := exec.Command(gobin, "test", "-count=1", "-run", "Decode|Encode|ReadLayer|Seek|Rewind|Reset|GoRunner|Limits", ".")
+	cmd.Env = append(os.Environ(), "GOEXPERIMENT=cgocheck2", "GOJXL_CGOCHECK=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("tests failed under cgocheck2: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,125 @@
+package gojxl
+
+import (
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <jxl/encode.h>
+// #include <jxl/codestream_header.h>
+import "C"
+
+// setBlack finds the extra channel that holds K in a CMYK image, leaving
+// d.black at -1 if the image is not CMYK or is converted to another space.
+func (d *JxlDecoder) setBlack() {
+	d.black = -1
+	if d.info.Channels == 3 && !d.converted {
+		for i, ec := range d.info.ExtraChannels {
+			if ec.Type == ChannelBlack {
+				d.black = i
+				break
+			}
+		}
+	}
+	d.info.CMYK = d.black >= 0
+}
+
+func (d *JxlDecoder) iccProfile() []byte {
+	var size C.size_t
+	if C.JxlDecoderGetICCProfileSize(d.decoder, C.JXL_COLOR_PROFILE_TARGET_DATA, &size) != C.JXL_DEC_SUCCESS || size == 0 {
+		return nil
+	}
+	icc := make([]byte, size)
+	if C.JxlDecoderGetColorAsICCProfile(d.decoder, C.JXL_COLOR_PROFILE_TARGET_DATA, (*C.uint8_t)(unsafe.Pointer(&icc[0])), size) != C.JXL_DEC_SUCCESS {
+		return nil
+	}
+	return icc
+}
+
+// ICCProfile returns the ICC profile that describes the decoded pixels,
+// such as the CMYK profile of a print image.
+func (d *JxlDecoder) ICCProfile() ([]byte, error) {
+	_, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	return d.icc, nil
+}
+
+// setCMYKBuffers has libjxl write CMY and K to separate buffers, which
+// unpackCMYK then interleaves. libjxl has no pixel format that includes an
+// extra channel.
+func (d *JxlDecoder) setCMYKBuffers(fmt *C.JxlPixelFormat, w, h int) C.JxlDecoderStatus {
+	if cap(d.cmy) < 3*w*h {
+		d.cmy = make([]byte, 3*w*h)
+		d.kbuf = make([]byte, w*h)
+	}
+	d.cmy, d.kbuf = d.cmy[:3*w*h], d.kbuf[:w*h]
+	status := d.setOutBuffer(fmt, d.cmy)
+	if status != C.JXL_DEC_SUCCESS {
+		return status
+	}
+	kfmt := *fmt
+	kfmt.num_channels = 1
+	d.pinner.Pin(&d.kbuf[0])
+	return C.JxlDecoderSetExtraChannelBuffer(d.decoder, &kfmt, unsafe.Pointer(&d.kbuf[0]), C.size_t(len(d.kbuf)), C.uint32_t(d.black))
+}
+
+// unpackCMYK fills dst in the layout of image.CMYK. JPEG XL stores 0 as
+// full ink, the reverse of Go.
+func (d *JxlDecoder) unpackCMYK(dst []byte, w, h, stride int) {
+	for y := 0; y < h; y++ {
+		row := dst[y*stride : y*stride+4*w]
+		cmy := d.cmy[3*w*y:]
+		k := d.kbuf[w*y:]
+		for x := 0; x < w; x++ {
+			row[4*x] = 255 - cmy[3*x]
+			row[4*x+1] = 255 - cmy[3*x+1]
+			row[4*x+2] = 255 - cmy[3*x+2]
+			row[4*x+3] = 255 - k[x]
+		}
+	}
+}
+
+func (e *JxlEncoder) setBlackChannel() C.JxlEncoderStatus {
+	var ec C.JxlExtraChannelInfo
+	C.JxlEncoderInitExtraChannelInfo(C.JXL_CHANNEL_BLACK, &ec)
+	ec.bits_per_sample = 8
+	return C.JxlEncoderSetExtraChannelInfo(e.encoder, 0, &ec)
+}
+
+// splitCMYK turns the rows of an image.CMYK into the CMY and K planes that
+// libjxl expects, inverting them on the way.
+func splitCMYK(b []byte, w, h, stride int) ([]byte, []byte, bool) {
+	if len(b) < stride*(h-1)+4*w {
+		return nil, nil, false
+	}
+	cmy := make([]byte, 3*w*h)
+	k := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		row := b[y*stride : y*stride+4*w]
+		for x := 0; x < w; x++ {
+			i := w*y + x
+			cmy[3*i] = 255 - row[4*x]
+			cmy[3*i+1] = 255 - row[4*x+1]
+			cmy[3*i+2] = 255 - row[4*x+2]
+			k[i] = 255 - row[4*x+3]
+		}
+	}
+	return cmy, k, true
+}
+
+func (e *JxlEncoder) addCMYKFrame(b []byte) C.JxlEncoderStatus {
+	cmy, k, ok := splitCMYK(b, e.x, e.y, rowStride(e.x, 4, int(e.pxFormat.align)))
+	if !ok {
+		return C.JXL_ENC_ERROR
+	}
+	format := e.pxFormat
+	format.align = 0
+	status := C.JxlEncoderAddImageFrame(e.settings, &format, unsafe.Pointer(&cmy[0]), C.size_t(len(cmy)))
+	if status != C.JXL_ENC_SUCCESS {
+		return status
+	}
+	format.num_channels = 1
+	return C.JxlEncoderSetExtraChannelBuffer(e.settings, &format, unsafe.Pointer(&k[0]), C.size_t(len(k)), 0)
+}
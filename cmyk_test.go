@@ -0,0 +1,209 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// cmykProfile builds a small but complete ICC v2 output profile for CMYK,
+// with lookup tables that map ink coverage to lightness.
+func cmykProfile() []byte {
+	be := binary.BigEndian
+	pad := func(b []byte) []byte {
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	text := func(s string) []byte {
+		b := append([]byte("text\x00\x00\x00\x00"), s...)
+		return pad(append(b, 0))
+	}
+	desc := func(s string) []byte {
+		b := append([]byte("desc\x00\x00\x00\x00"), be.AppendUint32(nil, uint32(len(s)+1))...)
+		b = append(append(b, s...), 0)
+		b = append(b, make([]byte, 4+4+2+1+67)...)
+		return pad(b)
+	}
+	// lut builds a lut16Type with a 2-point grid and linear curves. The
+	// grid maps coverage to Lab with a and b at 0.
+	lut := func(in, out int, entry func(corner int) []uint16) []byte {
+		b := append([]byte("mft2\x00\x00\x00\x00"), byte(in), byte(out), 2, 0)
+		for i := 0; i < 9; i++ {
+			v := uint32(0)
+			if i%4 == 0 {
+				v = 1 << 16
+			}
+			b = be.AppendUint32(b, v)
+		}
+		b = be.AppendUint16(b, 2)
+		b = be.AppendUint16(b, 2)
+		for i := 0; i < in; i++ {
+			b = be.AppendUint16(be.AppendUint16(b, 0), 0xffff)
+		}
+		for corner := 0; corner < 1<<in; corner++ {
+			for _, v := range entry(corner) {
+				b = be.AppendUint16(b, v)
+			}
+		}
+		for i := 0; i < out; i++ {
+			b = be.AppendUint16(be.AppendUint16(b, 0), 0xffff)
+		}
+		return pad(b)
+	}
+	a2b := lut(4, 3, func(corner int) []uint16 {
+		l := uint16(0xff00)
+		for ink := corner; ink != 0; ink >>= 1 {
+			if ink&1 != 0 {
+				l /= 2
+			}
+		}
+		return []uint16{l, 0x8000, 0x8000}
+	})
+	b2a := lut(3, 4, func(corner int) []uint16 {
+		k := uint16(0xffff)
+		if corner&4 != 0 {
+			k = 0
+		}
+		return []uint16{0, 0, 0, k}
+	})
+	wtpt := []byte("XYZ \x00\x00\x00\x00")
+	for _, v := range []uint32{0xf6d6, 0x10000, 0xd32d} {
+		wtpt = be.AppendUint32(wtpt, v)
+	}
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc("gojxl test CMYK")},
+		{"cprt", text("No copyright")},
+		{"wtpt", wtpt},
+		{"A2B0", a2b},
+		{"B2A0", b2a},
+	}
+	off := 128 + 4 + 12*len(tags)
+	var table, data []byte
+	table = be.AppendUint32(table, uint32(len(tags)))
+	for _, tag := range tags {
+		table = append(table, tag.sig...)
+		table = be.AppendUint32(table, uint32(off+len(data)))
+		table = be.AppendUint32(table, uint32(len(tag.data)))
+		data = append(data, tag.data...)
+	}
+	header := make([]byte, 128)
+	be.PutUint32(header, uint32(off+len(data)))
+	be.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "prtrCMYKLab ")
+	copy(header[36:], "acsp")
+	be.PutUint32(header[68:], 0xf6d6)
+	be.PutUint32(header[72:], 0x10000)
+	be.PutUint32(header[76:], 0xd32d)
+	return append(append(header, table...), data...)
+}
+
+func TestCMYKRoundTrip(t *testing.T) {
+	src := loadEncodeInput(t)
+	want := image.NewCMYK(src.Bounds())
+	draw.Draw(want, want.Rect, src, src.Rect.Min, draw.Src)
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, want, &jxl.EncoderOptions{Lossless: true, ICCProfile: cmykProfile()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jxl.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ColorModel != color.CMYKModel {
+		t.Error("expected CMYK, got", cfg.ColorModel)
+	}
+	img, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := img.(*image.CMYK)
+	if !ok {
+		t.Fatalf("expected *image.CMYK, got %T", img)
+	}
+	if got.Rect != want.Rect || !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("pixels differ after lossless round trip")
+	}
+}
+
+func TestCMYKReadImage(t *testing.T) {
+	src := loadEncodeInput(t)
+	want := image.NewCMYK(src.Bounds())
+	draw.Draw(want, want.Rect, src, src.Rect.Min, draw.Src)
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, want, &jxl.EncoderOptions{Lossless: true, ICCProfile: cmykProfile()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jxl.NewDecoder(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	r := want.Rect
+	padded := image.NewCMYK(image.Rect(0, 0, r.Dx()+3, r.Dy())).SubImage(r).(*image.CMYK)
+	_, err = d.ReadImage(padded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < r.Dy(); y++ {
+		if !bytes.Equal(padded.Pix[y*padded.Stride:y*padded.Stride+4*r.Dx()], want.Pix[y*want.Stride:(y+1)*want.Stride]) {
+			t.Fatal("row", y, "differs")
+		}
+	}
+	icc, err := d.ICCProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(icc, cmykProfile()) {
+		t.Error("embedded CMYK profile did not survive the round trip")
+	}
+}
+
+func TestCMYKWithoutProfile(t *testing.T) {
+	src := loadEncodeInput(t)
+	want := image.NewCMYK(src.Bounds())
+	draw.Draw(want, want.Rect, src, src.Rect.Min, draw.Src)
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, want, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ColorModel() == color.CMYKModel {
+		t.Fatal("expected CMYK without a profile to be converted to RGB")
+	}
+	r := want.Rect
+	for y := r.Min.Y; y < r.Max.Y; y += 17 {
+		for x := r.Min.X; x < r.Max.X; x += 17 {
+			wr, wg, wb, _ := want.At(x, y).RGBA()
+			gr, gg, gb, _ := img.At(x-r.Min.X, y-r.Min.Y).RGBA()
+			if wr>>8 != gr>>8 || wg>>8 != gg>>8 || wb>>8 != gb>>8 {
+				t.Fatal("pixel", x, y, "differs after conversion")
+			}
+		}
+	}
+	e := jxl.NewJxlEncoder(io.Discard)
+	defer e.Destroy()
+	if e.SetInfo(r.Dx(), r.Dy(), color.CMYKModel, 0) {
+		t.Error("expected SetInfo to refuse CMYK without a profile")
+	}
+	if !errors.Is(e.Err(), jxl.EncodeInfoError) {
+		t.Error("expected EncodeInfoError, got", e.Err())
+	}
+}
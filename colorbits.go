@@ -0,0 +1,188 @@
+package gojxl
+
+import "math"
+
+// The color encoding in a jhgm box is stored the way a JPEG XL codestream
+// stores it: bit-packed fields, least significant bit first. libjxl only
+// offers to read and write it as part of the whole box.
+
+// u32Dist lists the four ways a U32 field can be coded, as a number of bits
+// and an offset, chosen by a 2-bit selector.
+type u32Dist [4][2]uint32
+
+var (
+	enumDist = u32Dist{{0, 0}, {0, 1}, {4, 2}, {6, 18}}
+	xyDist   = u32Dist{{19, 0}, {19, 524288}, {20, 1048576}, {21, 2097152}}
+)
+
+const (
+	colorSpaceRGB   = 0
+	colorSpaceGray  = 1
+	colorSpaceXYB   = 2
+	whiteD65        = 1
+	whiteCustom     = 2
+	primariesSRGB   = 1
+	primariesCustom = 2
+	transferSRGB    = 13
+	transferGamma   = 65535
+	intentRelative  = 1
+	gammaBits       = 24
+	gammaScale      = 1e7
+	xyScale         = 1e6
+)
+
+type bitReader struct {
+	b   []byte
+	pos int
+	bad bool
+}
+
+func (r *bitReader) bits(n uint32) uint32 {
+	var v uint32
+	for i := uint32(0); i < n; i++ {
+		if r.pos >= 8*len(r.b) {
+			r.bad = true
+			return 0
+		}
+		v |= uint32(r.b[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) u32(d u32Dist) uint32 {
+	sel := d[r.bits(2)]
+	return sel[1] + r.bits(sel[0])
+}
+
+func (r *bitReader) xy() float64 {
+	u := r.u32(xyDist)
+	v := int32(u>>1) ^ -int32(u&1)
+	return float64(v) / xyScale
+}
+
+type bitWriter struct {
+	b []byte
+	n int
+}
+
+func (w *bitWriter) bits(v, n uint32) {
+	for i := uint32(0); i < n; i++ {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[len(w.b)-1] |= byte(v>>i&1) << (w.n % 8)
+		w.n++
+	}
+}
+
+func (w *bitWriter) u32(v uint32, d u32Dist) bool {
+	for sel, dist := range d {
+		if v >= dist[1] && uint64(v-dist[1]) < 1<<dist[0] {
+			w.bits(uint32(sel), 2)
+			w.bits(v-dist[1], dist[0])
+			return true
+		}
+	}
+	return false
+}
+
+func (w *bitWriter) xy(f float64) bool {
+	v := math.Round(f * xyScale)
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return false
+	}
+	s := int32(v)
+	return w.u32(uint32(s<<1^s>>31), xyDist)
+}
+
+// readColorEncoding decodes a color encoding, or returns nil if it is
+// malformed or only refers to an ICC profile.
+func readColorEncoding(b []byte) *ColorEncoding {
+	r := &bitReader{b: b}
+	e := &ColorEncoding{
+		ColorSpace:      colorSpaceRGB,
+		WhitePoint:      whiteD65,
+		Primaries:       primariesSRGB,
+		Transfer:        transferSRGB,
+		RenderingIntent: intentRelative,
+	}
+	if r.bits(1) != 0 {
+		return e
+	}
+	if r.bits(1) != 0 {
+		return nil
+	}
+	e.ColorSpace = int(r.u32(enumDist))
+	if e.ColorSpace != colorSpaceXYB {
+		e.WhitePoint = int(r.u32(enumDist))
+		if e.WhitePoint == whiteCustom {
+			e.WhitePointXY = [2]float64{r.xy(), r.xy()}
+		}
+	}
+	if e.ColorSpace != colorSpaceGray && e.ColorSpace != colorSpaceXYB {
+		e.Primaries = int(r.u32(enumDist))
+		if e.Primaries == primariesCustom {
+			e.RedXY = [2]float64{r.xy(), r.xy()}
+			e.GreenXY = [2]float64{r.xy(), r.xy()}
+			e.BlueXY = [2]float64{r.xy(), r.xy()}
+		}
+	}
+	if e.ColorSpace == colorSpaceXYB {
+		e.Transfer, e.Gamma = transferGamma, 1.0/3
+	} else if r.bits(1) != 0 {
+		e.Transfer = transferGamma
+		e.Gamma = float64(r.bits(gammaBits)) / gammaScale
+	} else {
+		e.Transfer = int(r.u32(enumDist))
+	}
+	e.RenderingIntent = int(r.u32(enumDist))
+	if r.bad {
+		return nil
+	}
+	return e
+}
+
+// appendColorEncoding encodes e, padded to a whole byte, or returns nil if
+// a field is out of range.
+func appendColorEncoding(b []byte, e *ColorEncoding) []byte {
+	w := &bitWriter{b: b}
+	if e.ColorSpace == colorSpaceRGB && e.WhitePoint == whiteD65 && e.Primaries == primariesSRGB &&
+		e.Transfer == transferSRGB && e.RenderingIntent == intentRelative {
+		w.bits(1, 1)
+		return w.b
+	}
+	w.bits(0, 1)
+	w.bits(0, 1)
+	ok := w.u32(uint32(e.ColorSpace), enumDist)
+	if e.ColorSpace != colorSpaceXYB {
+		ok = ok && w.u32(uint32(e.WhitePoint), enumDist)
+		if e.WhitePoint == whiteCustom {
+			ok = ok && w.xy(e.WhitePointXY[0]) && w.xy(e.WhitePointXY[1])
+		}
+	}
+	if e.ColorSpace != colorSpaceGray && e.ColorSpace != colorSpaceXYB {
+		ok = ok && w.u32(uint32(e.Primaries), enumDist)
+		if e.Primaries == primariesCustom {
+			for _, xy := range [][2]float64{e.RedXY, e.GreenXY, e.BlueXY} {
+				ok = ok && w.xy(xy[0]) && w.xy(xy[1])
+			}
+		}
+	}
+	if e.ColorSpace != colorSpaceXYB {
+		if e.Transfer == transferGamma {
+			g := math.Round(e.Gamma * gammaScale)
+			ok = ok && g > 0 && g < 1<<gammaBits
+			w.bits(1, 1)
+			w.bits(uint32(g), gammaBits)
+		} else {
+			w.bits(0, 1)
+			ok = ok && w.u32(uint32(e.Transfer), enumDist)
+		}
+	}
+	ok = ok && w.u32(uint32(e.RenderingIntent), enumDist)
+	if !ok {
+		return nil
+	}
+	return w.b
+}
@@ -0,0 +1,124 @@
+package gojxl
+
+import "unsafe"
+
+// #cgo linux darwin pkg-config: libjxl_cms
+// #cgo windows LDFLAGS: jxl_cms.dll
+// #include <jxl/decode.h>
+// #include <jxl/encode.h>
+// #include <jxl/cms.h>
+import "C"
+
+const DecodeColorError DecodeError = "cannot convert to the requested color profile"
+
+// ColorSpace is a color space that decoded pixels can be converted to.
+type ColorSpace int
+
+const (
+	// ColorAsStored leaves pixels in the image's own color space.
+	ColorAsStored ColorSpace = iota
+	ColorSRGB
+	ColorLinearSRGB
+	ColorDisplayP3
+)
+
+func (c ColorSpace) encoding(gray bool) C.JxlColorEncoding {
+	var enc C.JxlColorEncoding
+	isGray := C.JXL_BOOL(C.JXL_FALSE)
+	if gray {
+		isGray = C.JXL_TRUE
+	}
+	switch c {
+	case ColorLinearSRGB:
+		C.JxlColorEncodingSetToLinearSRGB(&enc, isGray)
+	case ColorDisplayP3:
+		C.JxlColorEncodingSetToSRGB(&enc, isGray)
+		if !gray {
+			enc.primaries = C.JXL_PRIMARIES_P3
+		}
+	default:
+		C.JxlColorEncodingSetToSRGB(&enc, isGray)
+	}
+	return enc
+}
+
+// converts reports whether the options ask for pixels in another profile.
+func (o *DecoderOptions) converts() bool {
+	return o.Color != ColorAsStored || len(o.OutputICC) != 0
+}
+
+// setCMS picks the CMS that converts to the requested profile. It must be
+// set before decoding starts.
+func (d *JxlDecoder) setCMS() {
+	if !d.opts.converts() {
+		return
+	}
+	cms := (*C.JxlCmsInterface)(d.opts.CMS)
+	if cms == nil {
+		cms = C.JxlGetDefaultCms()
+	}
+	C.JxlDecoderSetCms(d.decoder, *cms)
+}
+
+// setOutputColor asks libjxl for the requested profile once the image's own
+// profile is known.
+func (d *JxlDecoder) setOutputColor(gray bool) error {
+	if !d.opts.converts() {
+		return nil
+	}
+	var status C.JxlDecoderStatus
+	if icc := d.opts.OutputICC; len(icc) != 0 {
+		status = C.JxlDecoderSetOutputColorProfile(d.decoder, nil, (*C.uint8_t)(unsafe.Pointer(&icc[0])), C.size_t(len(icc)))
+	} else {
+		enc := d.opts.Color.encoding(gray)
+		status = C.JxlDecoderSetOutputColorProfile(d.decoder, &enc, nil, 0)
+	}
+	if status != C.JXL_DEC_SUCCESS {
+		return DecodeColorError
+	}
+	d.converted = true
+	return nil
+}
+
+// ColorEncoding mirrors libjxl's JxlColorEncoding. The enumerated fields
+// hold libjxl's values.
+type ColorEncoding struct {
+	ColorSpace             int
+	WhitePoint             int
+	WhitePointXY           [2]float64
+	Primaries              int
+	RedXY, GreenXY, BlueXY [2]float64
+	Transfer               int
+	Gamma                  float64
+	RenderingIntent        int
+}
+
+func newColorEncoding(c *C.JxlColorEncoding) *ColorEncoding {
+	return &ColorEncoding{
+		ColorSpace:      int(c.color_space),
+		WhitePoint:      int(c.white_point),
+		WhitePointXY:    [2]float64{float64(c.white_point_xy[0]), float64(c.white_point_xy[1])},
+		Primaries:       int(c.primaries),
+		RedXY:           [2]float64{float64(c.primaries_red_xy[0]), float64(c.primaries_red_xy[1])},
+		GreenXY:         [2]float64{float64(c.primaries_green_xy[0]), float64(c.primaries_green_xy[1])},
+		BlueXY:          [2]float64{float64(c.primaries_blue_xy[0]), float64(c.primaries_blue_xy[1])},
+		Transfer:        int(c.transfer_function),
+		Gamma:           float64(c.gamma),
+		RenderingIntent: int(c.rendering_intent),
+	}
+}
+
+func (e *ColorEncoding) c() C.JxlColorEncoding {
+	var c C.JxlColorEncoding
+	c.color_space = C.JxlColorSpace(e.ColorSpace)
+	c.white_point = C.JxlWhitePoint(e.WhitePoint)
+	c.white_point_xy = [2]C.double{C.double(e.WhitePointXY[0]), C.double(e.WhitePointXY[1])}
+	c.primaries = C.JxlPrimaries(e.Primaries)
+	c.primaries_red_xy = [2]C.double{C.double(e.RedXY[0]), C.double(e.RedXY[1])}
+	c.primaries_green_xy = [2]C.double{C.double(e.GreenXY[0]), C.double(e.GreenXY[1])}
+	c.primaries_blue_xy = [2]C.double{C.double(e.BlueXY[0]), C.double(e.BlueXY[1])}
+	c.transfer_function = C.JxlTransferFunction(e.Transfer)
+	c.gamma = C.double(e.Gamma)
+	c.rendering_intent = C.JxlRenderingIntent(e.RenderingIntent)
+	return c
+}
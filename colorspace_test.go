@@ -0,0 +1,95 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"math/bits"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestDecodeToSRGB(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profiles [][]byte
+	for _, c := range []jxl.ColorSpace{jxl.ColorSRGB, jxl.ColorDisplayP3} {
+		d, err := jxl.NewJxlDecoderFromBytes(data, &jxl.DecoderOptions{Color: c})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Destroy()
+		icc, err := d.ICCProfile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		profiles = append(profiles, icc)
+	}
+	if len(profiles[0]) == 0 || bytes.Equal(profiles[0], profiles[1]) {
+		t.Error("expected distinct sRGB and Display P3 profiles")
+	}
+	img, err := jxl.DecodeWithOptions(bytes.NewReader(data), &jxl.DecoderOptions{Color: jxl.ColorSRGB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := bits.OnesCount64(dhash(img) ^ DecodeSingleImgHash); d > 2 {
+		t.Errorf("hash differs in %d bits", d)
+	}
+}
+
+func TestDecodeToLinear(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = 128
+	}
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, src, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jxl.DecodeWithOptions(buf, &jxl.DecoderOptions{Color: jxl.ColorLinearSRGB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected *image.Gray, got %T", img)
+	}
+	// sRGB 128 is about 21.6% in linear light.
+	if v := g.Pix[0]; v < 53 || v > 57 {
+		t.Error("expected a linear value near 55, got", v)
+	}
+}
+
+func TestIntensityTarget(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	for _, target := range []float64{0, 4000} {
+		buf := new(bytes.Buffer)
+		err := jxl.EncodeWithOptions(buf, src, &jxl.EncoderOptions{IntensityTarget: target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := jxl.NewDecoder(buf, &jxl.DecoderOptions{Color: jxl.ColorSRGB, IntensityTarget: 255})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Destroy()
+		info, err := d.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := target
+		if want == 0 {
+			want = 255
+		}
+		if info.IntensityTarget != want {
+			t.Errorf("expected intensity target %v, got %v", want, info.IntensityTarget)
+		}
+		if _, err = d.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
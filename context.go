@@ -0,0 +1,197 @@
+package gojxl
+
+import (
+	"context"
+	"image"
+	"io"
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <jxl/encode.h>
+// #include <jxl/parallel_runner.h>
+// #include <jxl/resizable_parallel_runner.h>
+// #include <stdint.h>
+// #include <stdlib.h>
+// extern JxlParallelRetCode goJxlRunner(void*, void*, JxlParallelRunInit, JxlParallelRunFunction, uint32_t, uint32_t);
+// typedef struct {
+//     JxlParallelRunner inner;
+//     void *opaque;
+//     int done;
+// } jxlCancelRunner;
+// static JxlParallelRetCode jxlCancelRun(void *runner_opaque, void *jpegxl_opaque, JxlParallelRunInit init, JxlParallelRunFunction func, uint32_t start_range, uint32_t end_range) {
+//     jxlCancelRunner *c = runner_opaque;
+//     if (__atomic_load_n(&c->done, __ATOMIC_RELAXED)) return JXL_PARALLEL_RET_RUNNER_ERROR;
+//     if (c->inner != NULL) return c->inner(c->opaque, jpegxl_opaque, init, func, start_range, end_range);
+//     JxlParallelRetCode ret = init(jpegxl_opaque, 1);
+//     if (ret != 0) return ret;
+//     for (uint32_t i = start_range; i < end_range; i++) {
+//         if (__atomic_load_n(&c->done, __ATOMIC_RELAXED)) return JXL_PARALLEL_RET_RUNNER_ERROR;
+//         func(jpegxl_opaque, i, 0);
+//     }
+//     return 0;
+// }
+// static jxlCancelRunner *jxlCancelRunnerNew(JxlParallelRunner inner, void *opaque) {
+//     jxlCancelRunner *c = calloc(1, sizeof(jxlCancelRunner));
+//     if (c == NULL) return NULL;
+//     c->inner = inner;
+//     c->opaque = opaque;
+//     return c;
+// }
+// static void jxlCancelSet(jxlCancelRunner *c, int v) {
+//     __atomic_store_n(&c->done, v, __ATOMIC_RELAXED);
+// }
+// static int jxlCancelGet(jxlCancelRunner *c) {
+//     return __atomic_load_n(&c->done, __ATOMIC_RELAXED);
+// }
+import "C"
+
+// cancelRunner sits between libjxl and the real parallel runner (or none,
+// for ThreadsSingle) so that work can be abandoned once a context is done.
+type cancelRunner C.jxlCancelRunner
+
+// newCancelRunner wraps r, or else runner. r stays attached until the
+// cancelRunner is freed. It only fails if r is closed; a nil cancelRunner
+// means it could not be allocated.
+func newCancelRunner(r *GoRunner, runner unsafe.Pointer) (*cancelRunner, error) {
+	var c *C.jxlCancelRunner
+	if r != nil {
+		if err := r.attach(); err != nil {
+			return nil, err
+		}
+		c = C.jxlCancelRunnerNew((*[0]byte)(C.goJxlRunner), r.opaque())
+		if c == nil {
+			r.detach()
+		}
+	} else if runner != nil {
+		c = C.jxlCancelRunnerNew((*[0]byte)(C.JxlResizableParallelRunner), runner)
+	} else {
+		c = C.jxlCancelRunnerNew(nil, nil)
+	}
+	return (*cancelRunner)(c), nil
+}
+
+func (c *cancelRunner) setDecoder(dec *C.JxlDecoder) {
+	C.JxlDecoderSetParallelRunner(dec, (*[0]byte)(C.jxlCancelRun), unsafe.Pointer(c))
+}
+
+func (c *cancelRunner) setEncoder(enc *C.JxlEncoder) {
+	C.JxlEncoderSetParallelRunner(enc, (*[0]byte)(C.jxlCancelRun), unsafe.Pointer(c))
+}
+
+func (c *cancelRunner) cancelled() bool {
+	return c != nil && C.jxlCancelGet((*C.jxlCancelRunner)(c)) != 0
+}
+
+func (c *cancelRunner) set(v C.int) {
+	C.jxlCancelSet((*C.jxlCancelRunner)(c), v)
+}
+
+// watch flags c as cancelled once ctx is done. The returned function must be
+// called before c is freed; it waits for a pending flag and clears it.
+func (c *cancelRunner) watch(ctx context.Context) func() {
+	if c == nil {
+		return func() {}
+	}
+	if ctx.Err() != nil {
+		c.set(1)
+		return func() { c.set(0) }
+	}
+	done := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		c.set(1)
+		close(done)
+	})
+	return func() {
+		if !stop() {
+			<-done
+			c.set(0)
+		}
+	}
+}
+
+func freeCancelRunner(c *cancelRunner, r *GoRunner) {
+	if c != nil {
+		if r != nil {
+			r.detach()
+		}
+		C.free(unsafe.Pointer(c))
+	}
+}
+
+// ReadContext is Read, but gives up once ctx is done. A cancelled decoder is
+// destroyed and ctx.Err() is returned.
+func (d *JxlDecoder) ReadContext(ctx context.Context) ([]byte, error) {
+	stop := d.cancel.watch(ctx)
+	d.ctx = ctx
+	buf, err := d.Read()
+	d.ctx = nil
+	stop()
+	if err != nil && ctx.Err() != nil {
+		d.Destroy()
+		return nil, ctx.Err()
+	}
+	return buf, err
+}
+
+// WriteContext is Write, but gives up once ctx is done. A cancelled encoder
+// is aborted and ctx.Err() is returned.
+func (e *JxlEncoder) WriteContext(ctx context.Context, b []byte) error {
+	stop := e.cancel.watch(ctx)
+	err := e.Write(b)
+	stop()
+	if err != nil && ctx.Err() != nil {
+		e.Abort()
+		return ctx.Err()
+	}
+	return err
+}
+
+// CloseContext is Close, but gives up on encoding the queued frame once ctx
+// is done.
+func (e *JxlEncoder) CloseContext(ctx context.Context) error {
+	stop := e.cancel.watch(ctx)
+	err := e.finish()
+	stop()
+	e.free()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func DecodeContext(ctx context.Context, r io.Reader, opts *DecoderOptions) (image.Image, error) {
+	d, err := NewDecoder(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Destroy()
+	stop := d.cancel.watch(ctx)
+	d.ctx = ctx
+	img, err := d.image()
+	stop()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return img, err
+}
+
+func EncodeContext(ctx context.Context, w io.Writer, img image.Image, opts *EncoderOptions) error {
+	buf, model, stride := packImage(img, opts != nil && len(opts.ICCProfile) != 0)
+	if opts != nil && opts.Alpha != AlphaAuto {
+		o := *opts
+		o.Alpha = AlphaAuto
+		opts = &o
+	}
+	e, err := NewEncoder(w, opts)
+	if err != nil {
+		return err
+	}
+	defer e.Destroy()
+	rect := img.Bounds()
+	if !e.SetInfo(rect.Dx(), rect.Dy(), model, 0) {
+		return e.Err()
+	}
+	e.pxFormat.align = C.size_t(stride)
+	return e.WriteContext(ctx, buf)
+}
@@ -0,0 +1,159 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/devedge/imagehash"
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// cancelReader cancels its context once n bytes have been read from it.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n -= n
+	if c.n <= 0 && c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	return n, err
+}
+
+func TestDecodeContext(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := jxl.DecodeContext(context.Background(), f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := imagehash.DhashHorizontal(img, 8)
+	h := binary.BigEndian.Uint64(h2)
+	if h != DecodeSingleImgHash {
+		t.Error("crc does not match", DecodeSingleImgHash, h)
+	}
+}
+
+func TestDecodeContextCanceled(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = jxl.DecodeContext(ctx, f, nil)
+	if err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+func TestReadContextCanceled(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancelReader{r: f, n: int(fi.Size() / 2), cancel: cancel}
+	d := jxl.NewJxlDecoder(r)
+	defer d.Destroy()
+	for {
+		out, err := d.ReadContext(ctx)
+		if err != nil {
+			if err != context.Canceled {
+				t.Fatal("expected context.Canceled, got", err)
+			}
+			break
+		}
+		if out == nil {
+			t.Fatal("decoded to the end despite cancellation")
+		}
+	}
+	_, err = d.Read()
+	if err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError, got", err)
+	}
+}
+
+func TestReadContextDeadline(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	d := jxl.NewJxlDecoderWithOptions(f, &jxl.DecoderOptions{Threads: jxl.ThreadsSingle})
+	defer d.Destroy()
+	_, err = d.ReadContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+}
+
+func TestEncodeContext(t *testing.T) {
+	f, err := os.Open(EncodeSingleImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	i, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeContext(context.Background(), buf, i, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	err = jxl.EncodeContext(ctx, buf, i, nil)
+	if err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+func TestWriteContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := jxl.NewJxlEncoder(io.Discard)
+	defer e.Destroy()
+	e.SetInfo(16, 16, color.GrayModel, 10)
+	frame := make([]byte, 16*16)
+	err := e.WriteContext(ctx, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err = e.WriteContext(ctx, frame)
+	if err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	err = e.Write(frame)
+	if !errors.Is(err, jxl.EncodeClosedError) {
+		t.Error("expected EncodeClosedError, got", err)
+	}
+}
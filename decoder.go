@@ -1,9 +1,11 @@
 package gojxl
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"io"
+	"runtime"
 	"time"
 	"unsafe"
 )
@@ -15,6 +17,7 @@ import (
 // #include <jxl/types.h>
 // #include <jxl/resizable_parallel_runner.h>
 // #include <stdint.h>
+// #include <stdlib.h>
 import "C"
 
 const jxlHeader = "\xff\x0a"
@@ -27,125 +30,387 @@ func (e DecodeError) Error() string { return "jxl decode error: " + string(e) }
 const DecodeHeaderError DecodeError = "invalid header"
 const DecodeInputError DecodeError = "unable to set input"
 const DecodeDataError DecodeError = "invalid body"
+const DecodeSeekError DecodeError = "cannot rewind input"
+const DecodeAllocError DecodeError = "failed to allocate decoder"
+const DecodeClosedError DecodeError = "decoder is closed"
+const DecodeBufferError DecodeError = "output buffer does not fit the frame"
+const DecodeUnfinishedError DecodeError = "image is not fully decoded"
+const DecodeFormatError DecodeError = "image type not supported"
 
 func init() {
 	image.RegisterFormat("jxl", jxlHeader, Decode, DecodeConfig)
 }
 
+type DecoderOptions struct {
+	// Layers disables coalescing, so each layer is returned on its own by
+	// ReadLayer. Layers need not cover the canvas, so the other ways of
+	// reading pixels fail with DecodeFormatError.
+	Layers bool
+	// Threads is ThreadsAuto, ThreadsSingle, or a fixed number of worker threads.
+	Threads int
+	// Runner, if set, replaces the decoder's own thread pool.
+	Runner *GoRunner
+	Limits DecoderLimits
+	// Pool, if set, supplies the buffers returned by Read and the Decode helpers.
+	Pool *FramePool
+	// Align pads each row of a decoded frame to a multiple of this many bytes.
+	Align int
+	// Alpha picks straight or premultiplied output regardless of what the
+	// image declares. Info reports the result in AlphaPremult, and what the
+	// image declares in FileAlphaPremult.
+	Alpha AlphaMode
+	// Color converts decoded pixels to a standard color space, and OutputICC
+	// to the color space of an ICC profile, which takes precedence.
+	Color     ColorSpace
+	OutputICC []byte
+	// CMS, if set, points to a C JxlCmsInterface that replaces libjxl's own
+	// color management for these conversions.
+	CMS unsafe.Pointer
+	// IntensityTarget, if set, is the peak luminance in nits of the display
+	// the image is rendered for. Together with Color, it tone maps HDR
+	// images for SDR screens.
+	IntensityTarget float64
+}
+
 type JxlDecoder struct {
 	decoder      *C.JxlDecoder
+	opts         DecoderOptions
+	budget       *memBudget
 	runner       unsafe.Pointer
+	cancel       *cancelRunner
+	ctx          context.Context
+	cbuf         unsafe.Pointer
 	buf          []byte
+	inLen        int
+	left         int
+	pending      int
+	pinner       runtime.Pinner
+	boxPinner    runtime.Pinner
+	events       Event
+	whole        bool
+	in           []byte
+	cin          unsafe.Pointer
+	inPinner     runtime.Pinner
 	r            io.Reader
+	start        int64
 	hasInfo      bool
 	hitEnd       bool
+	closed       bool
+	inFrame      bool
+	stage        DecodeStage
+	err          error
+	consumed     int64
+	pixels       int64
+	frame        int
+	firstFrame   int
+	firstTime    time.Duration
+	fmt          C.JxlPixelFormat
+	header       C.JxlFrameHeader
+	frameName    string
+	durations    []time.Duration
 	lastFrameDur time.Duration
 	durFrac      time.Duration
+	info         JxlInfo
+	black        int
+	extra        []ExtraChannel
+	converted    bool
+	icc          []byte
+	cmy, kbuf    []byte
 }
 
+// JxlInfo is the basic info of an image. Its JSON form uses libjxl's field
+// names, except for cmyk and extra_channels, which libjxl does not have.
+// AlphaPremult tells whether decoded pixels are premultiplied once
+// DecoderOptions.Alpha is applied, so only FileAlphaPremult, what the image
+// declares, is in the JSON form.
 type JxlInfo struct {
-	H, W               int
-	BitDepth           int
-	Channels           int
-	Alpha              int
-	AlphaPremult       bool
-	Orientation        int
-	PreviewH, PreviewW int
-	Animated           bool
+	H                   int  `json:"ysize"`
+	W                   int  `json:"xsize"`
+	BitDepth            int  `json:"bits_per_sample"`
+	ExponentBits        int  `json:"exponent_bits_per_sample"`
+	Channels            int  `json:"num_color_channels"`
+	Alpha               int  `json:"alpha_bits"`
+	AlphaExponentBits   int  `json:"alpha_exponent_bits"`
+	AlphaPremult        bool `json:"-"`
+	FileAlphaPremult    bool `json:"alpha_premultiplied"`
+	Orientation         int  `json:"orientation"`
+	PreviewH            int  `json:"preview_ysize,omitempty"`
+	PreviewW            int  `json:"preview_xsize,omitempty"`
+	IntrinsicH          int  `json:"intrinsic_ysize"`
+	IntrinsicW          int  `json:"intrinsic_xsize"`
+	Container           bool `json:"have_container"`
+	UsesOriginalProfile bool `json:"uses_original_profile"`
+	Animated            bool `json:"have_animation"`
+	// TPSNumerator/TPSDenominator is the animation's ticks per second, and
+	// Loops its number of repetitions, 0 meaning forever.
+	TPSNumerator   int  `json:"tps_numerator,omitempty"`
+	TPSDenominator int  `json:"tps_denominator,omitempty"`
+	Loops          int  `json:"num_loops,omitempty"`
+	Timecodes      bool `json:"have_timecodes,omitempty"`
+	CMYK           bool `json:"cmyk"`
+	// IntensityTarget is the peak luminance of the image in nits. Images
+	// above 255 are HDR and need tone mapping for SDR screens.
+	IntensityTarget float64 `json:"intensity_target"`
+	MinNits         float64 `json:"min_nits"`
+	// RelativeToMaxDisplay means tone mapping scales LinearBelow by the
+	// display's peak luminance; otherwise LinearBelow is in nits.
+	RelativeToMaxDisplay bool    `json:"relative_to_max_display"`
+	LinearBelow          float64 `json:"linear_below"`
+	// ExtraChannels includes the alpha channel, if any. It is shared with
+	// the decoder and must not be modified.
+	ExtraChannels []ExtraChannel `json:"extra_channels"`
 }
 
 func NewJxlDecoder(r io.Reader) *JxlDecoder {
-	d := new(JxlDecoder)
-	runner, err := C.JxlResizableParallelRunnerCreate(nil)
-	if runner == nil {
+	return NewJxlDecoderWithOptions(r, nil)
+}
+
+func NewJxlDecoderWithOptions(r io.Reader, opts *DecoderOptions) *JxlDecoder {
+	d, err := NewDecoder(r, opts)
+	if err != nil {
 		panic(err)
 	}
-	d.runner = runner
-	d2, err := C.JxlDecoderCreate(nil)
-	if d2 == nil {
-		panic(err)
+	return d
+}
+
+func NewDecoder(r io.Reader, opts *DecoderOptions) (*JxlDecoder, error) {
+	d, err := newDecoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	d.setReader(r)
+	return d, nil
+}
+
+func newDecoder(opts *DecoderOptions) (*JxlDecoder, error) {
+	d := new(JxlDecoder)
+	if opts != nil {
+		d.opts = *opts
+	}
+	d.events = DefaultEvents
+	if err := d.create(); err != nil {
+		d.Destroy()
+		return nil, err
 	}
-	C.JxlDecoderSetParallelRunner(d2, (*[0]byte)(C.JxlResizableParallelRunner), runner)
-	C.JxlDecoderSubscribeEvents(d2, C.JXL_DEC_BASIC_INFO|C.JXL_DEC_FRAME|C.JXL_DEC_FULL_IMAGE)
-	d.decoder = d2
-	d.buf = make([]byte, block_size)
+	d.setup()
+	return d, nil
+}
+
+// create allocates the libjxl decoder and what it runs on. It is also how
+// Reset brings back a destroyed decoder.
+func (d *JxlDecoder) create() error {
+	runtime.SetFinalizer(d, (*JxlDecoder).Destroy)
+	if d.opts.Runner == nil {
+		runner, ok := newRunner(d.opts.Threads)
+		if !ok {
+			return DecodeAllocError
+		}
+		d.runner = runner
+	}
+	if d.opts.Limits.MaxMemory > 0 {
+		d.budget = newBudget(d.opts.Limits.MaxMemory)
+		if d.budget == nil {
+			return DecodeAllocError
+		}
+	}
+	cancel, err := newCancelRunner(d.opts.Runner, d.runner)
+	if err != nil {
+		return err
+	}
+	d.cancel = cancel
+	d.decoder = C.JxlDecoderCreate(d.memoryManager())
+	if d.cancel == nil || d.decoder == nil {
+		return DecodeAllocError
+	}
+	return nil
+}
+
+func (d *JxlDecoder) setReader(r io.Reader) {
+	d.freeInput()
 	d.r = r
-	return d
+	d.start = 0
+	if s, ok := r.(io.Seeker); ok {
+		d.start, _ = s.Seek(0, io.SeekCurrent)
+	}
+}
+
+func (d *JxlDecoder) setup() {
+	d.cancel.setDecoder(d.decoder)
+	C.JxlDecoderSubscribeEvents(d.decoder, C.int(d.events))
+	if d.opts.Layers {
+		C.JxlDecoderSetCoalescing(d.decoder, C.JXL_FALSE)
+	}
+	if d.opts.Alpha == AlphaStraight {
+		C.JxlDecoderSetUnpremultiplyAlpha(d.decoder, C.JXL_TRUE)
+	}
+	d.setCMS()
+	if d.opts.IntensityTarget > 0 {
+		C.JxlDecoderSetDesiredIntensityTarget(d.decoder, C.float(d.opts.IntensityTarget))
+	}
 }
 
 func (d *JxlDecoder) Destroy() {
-	C.JxlDecoderDestroy(d.decoder)
-	C.JxlResizableParallelRunnerDestroy(d.runner)
-	d.decoder = nil
+	if d.decoder != nil {
+		C.JxlDecoderDestroy(d.decoder)
+		d.decoder = nil
+	}
+	destroyRunner(d.runner)
 	d.runner = nil
+	freeCancelRunner(d.cancel, d.opts.Runner)
+	d.cancel = nil
+	d.freeBudget()
+	d.pinner.Unpin()
+	d.boxPinner.Unpin()
+	d.freeInput()
+	if d.cbuf != nil {
+		C.free(d.cbuf)
+		d.cbuf = nil
+	}
+	d.buf = nil
+	runtime.SetFinalizer(d, nil)
+}
+
+func (d *JxlDecoder) Close() error {
+	d.Destroy()
+	return nil
 }
 
 func (d *JxlDecoder) nextInput() error {
-	remain := int(C.JxlDecoderReleaseInput(d.decoder))
-	if remain > 0 {
-		copy(d.buf, d.buf[len(d.buf)-remain:])
+	if d.whole {
+		return d.setWholeInput()
 	}
-	n, err := io.ReadFull(d.r, d.buf[remain:])
-	if err != nil && err != io.ErrUnexpectedEOF {
-		return err
+	if d.cbuf == nil {
+		d.cbuf = C.malloc(block_size)
+		if d.cbuf == nil {
+			return d.failed(DecodeAllocError)
+		}
+		d.buf = unsafe.Slice((*byte)(d.cbuf), block_size)
+	}
+	remain := int(C.JxlDecoderReleaseInput(d.decoder))
+	n := 0
+	if d.pending > 0 {
+		// Bytes left over from the previous image go in before anything new is read.
+		remain, d.pending = d.pending, 0
+	} else {
+		if remain > 0 {
+			copy(d.buf, d.buf[d.inLen-remain:d.inLen])
+		}
+		var err error
+		n, err = d.fill(d.buf[remain:])
+		if err != nil {
+			// Hand back what libjxl had not used, in case the input is
+			// closed next.
+			d.inLen = remain
+			C.JxlDecoderSetInput(d.decoder, (*C.uchar)(d.cbuf), C.size_t(remain))
+			return d.failed(err)
+		}
+		d.consumed += int64(n)
+		if err = checkLimit("input bytes", d.consumed, d.opts.Limits.MaxInputBytes); err != nil {
+			d.err = d.failed(err)
+			return d.err
+		}
 	}
 	n += remain
-	status := C.JxlDecoderSetInput(d.decoder, (*C.uchar)(unsafe.Pointer(&d.buf[0])), C.size_t(n))
+	d.inLen = n
+	status := C.JxlDecoderSetInput(d.decoder, (*C.uchar)(d.cbuf), C.size_t(n))
 	if status != C.JXL_DEC_SUCCESS {
-		return DecodeInputError
+		return d.failed(DecodeInputError)
 	}
 	return nil
 }
 
+// process runs libjxl up to the next event, unless the current context is done.
+// The context is checked directly as well, since the runner is only flagged
+// once its AfterFunc gets to run.
+func (d *JxlDecoder) process() C.JxlDecoderStatus {
+	if d.cancel.cancelled() || d.ctx != nil && d.ctx.Err() != nil {
+		return C.JXL_DEC_ERROR
+	}
+	return C.JxlDecoderProcessInput(d.decoder)
+}
+
 func (d *JxlDecoder) Info() (JxlInfo, error) {
+	if d.decoder == nil {
+		return JxlInfo{}, DecodeClosedError
+	}
+	if d.err != nil {
+		return JxlInfo{}, d.err
+	}
+	if d.events&DefaultEvents != DefaultEvents {
+		// Without them, hasInfo is never set and Read cannot finish a frame.
+		return JxlInfo{}, DecodeEventsError
+	}
 	for !d.hasInfo {
-		err := d.nextInput()
+		ev, err := d.Next()
 		if err != nil {
 			return JxlInfo{}, err
 		}
-		status := C.JxlDecoderProcessInput(d.decoder)
-		if status == C.JXL_DEC_ERROR {
-			return JxlInfo{}, DecodeHeaderError
-		} else if status != C.JXL_DEC_NEED_MORE_INPUT {
-			d.hasInfo = true
-			break
+		if ev == EventSuccess {
+			return JxlInfo{}, d.failed(DecodeHeaderError)
 		}
 	}
+	return d.info, nil
+}
+
+// loadInfo reads the basic info once libjxl has it and sets up everything
+// that depends on it, so that Info and the event getters are cheap.
+func (d *JxlDecoder) loadInfo() {
 	var info C.JxlBasicInfo
 	C.JxlDecoderGetBasicInfo(d.decoder, &info)
 	var output JxlInfo
 	output.Alpha = int(info.alpha_bits)
-	output.AlphaPremult = info.alpha_premultiplied != 0
+	output.FileAlphaPremult = info.alpha_premultiplied != 0
+	output.AlphaPremult = output.FileAlphaPremult
+	if output.Alpha != 0 {
+		output.AlphaPremult = d.opts.Alpha.resolve(output.AlphaPremult)
+	}
+	output.AlphaExponentBits = int(info.alpha_exponent_bits)
 	output.Animated = info.have_animation != 0
 	output.BitDepth = int(info.bits_per_sample)
+	output.ExponentBits = int(info.exponent_bits_per_sample)
 	output.Channels = int(info.num_color_channels)
 	output.PreviewW = int(info.preview.xsize)
 	output.PreviewH = int(info.preview.ysize)
 	output.W, output.H = int(info.xsize), int(info.ysize)
+	output.IntrinsicW, output.IntrinsicH = int(info.intrinsic_xsize), int(info.intrinsic_ysize)
+	output.Container = info.have_container != 0
+	output.UsesOriginalProfile = info.uses_original_profile != 0
+	if output.Animated {
+		output.TPSNumerator = int(info.animation.tps_numerator)
+		output.TPSDenominator = int(info.animation.tps_denominator)
+		output.Loops = int(info.animation.num_loops)
+		output.Timecodes = info.animation.have_timecodes != 0
+	}
 	output.Orientation = int(info.orientation)
+	output.IntensityTarget = float64(info.intensity_target)
+	output.MinNits = float64(info.min_nits)
+	output.RelativeToMaxDisplay = info.relative_to_max_display != 0
+	output.LinearBelow = float64(info.linear_below)
+	output.ExtraChannels = d.extraChannels(&info)
+	d.info = output
+	d.setBlack()
+	tuneRunner(d.runner, d.opts.Threads, output.W, output.H)
 	if output.Animated {
 		d.durFrac = time.Second / time.Duration(info.animation.tps_numerator) * time.Duration(info.animation.tps_denominator)
 	}
-	return output, nil
 }
 
 func (d *JxlDecoder) FrameDuration() time.Duration {
 	return d.lastFrameDur
 }
 
-func (d *JxlDecoder) Read() ([]byte, error) {
-	if d.hitEnd {
-		return nil, nil
-	}
-	info, err := d.Info()
-	if err != nil {
-		return nil, err
+func pixelFormat(info JxlInfo, align int) (C.JxlPixelFormat, int) {
+	var fmt C.JxlPixelFormat
+	if info.CMYK {
+		// CMY goes to a packed scratch buffer, see setCMYKBuffers.
+		fmt.num_channels = 3
+		fmt.data_type = C.JXL_TYPE_UINT8
+		return fmt, 4
 	}
 	sz := info.Channels
 	if sz != 1 {
 		sz += 1
 	}
-	var fmt C.JxlPixelFormat
 	fmt.endianness = C.JXL_BIG_ENDIAN
 	fmt.num_channels = C.uint32_t(sz)
 	fmt.data_type = C.JXL_TYPE_UINT8
@@ -153,62 +418,213 @@ func (d *JxlDecoder) Read() ([]byte, error) {
 		sz *= 2
 		fmt.data_type = C.JXL_TYPE_UINT16
 	}
-	outbuf := make([]byte, sz*info.H*info.W)
-	status := C.JxlDecoderSetImageOutBuffer(d.decoder, &fmt, unsafe.Pointer(&outbuf[0]), C.size_t(len(outbuf)))
-	for status != C.JXL_DEC_SUCCESS {
-		err = d.nextInput()
+	fmt.align = C.size_t(align)
+	return fmt, sz
+}
+
+// rowStride is the distance in bytes between rows of w pixels of sz bytes
+// each, once libjxl has padded them to align. An align of at least a whole
+// row is the stride itself, which is how explicit strides are passed on.
+func rowStride(w, sz, align int) int {
+	row := w * sz
+	if align > 1 {
+		row = (row + align - 1) / align * align
+	}
+	return row
+}
+
+func (d *JxlDecoder) Read() ([]byte, error) {
+	return d.read(d.opts.Align, d.newFrame)
+}
+
+// newFrame allocates n bytes for a frame that needs at least min of them.
+func (d *JxlDecoder) newFrame(n, min int) ([]byte, error) {
+	if d.opts.Pool != nil {
+		return d.opts.Pool.Get(n), nil
+	}
+	return make([]byte, n), nil
+}
+
+func (d *JxlDecoder) read(align int, alloc func(n, min int) ([]byte, error)) ([]byte, error) {
+	if d.opts.Layers {
+		return nil, DecodeFormatError
+	}
+	if d.hitEnd {
+		return nil, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	if !d.inFrame && d.header.is_last != C.JXL_FALSE {
+		return nil, d.finish()
+	}
+	// The format lives in d, since a local passed to C would be moved to the
+	// heap on every frame.
+	var sz int
+	d.fmt, sz = pixelFormat(info, align)
+	stride := rowStride(info.W, sz, align)
+	outbuf, err := alloc(stride*info.H, stride*(info.H-1)+sz*info.W)
+	if err != nil {
+		return nil, err
+	}
+	setBuffers := func() C.JxlDecoderStatus {
+		if info.CMYK {
+			return d.setCMYKBuffers(&d.fmt, info.W, info.H)
+		}
+		return d.setOutBuffer(&d.fmt, outbuf)
+	}
+	// Setting the buffers up front saves libjxl from asking for them, but
+	// it may not accept them yet.
+	setBuffers()
+	for {
+		ev, err := d.Next()
 		if err != nil {
 			return nil, err
 		}
-		status = C.JxlDecoderProcessInput(d.decoder)
-		if status == C.JXL_DEC_NEED_IMAGE_OUT_BUFFER {
-			status = C.JxlDecoderSetImageOutBuffer(d.decoder, &fmt, unsafe.Pointer(&outbuf[0]), C.size_t(len(outbuf)))
+		switch ev {
+		case EventSuccess:
+			d.pinner.Unpin()
+			return nil, nil
+		case EventNeedImageOutBuffer:
+			if setBuffers() != C.JXL_DEC_SUCCESS {
+				return nil, d.failed(DecodeDataError)
+			}
+		case EventFullImage:
+			if info.CMYK {
+				d.unpackCMYK(outbuf, info.W, info.H, stride)
+			} else if d.mustPremultiply(info) {
+				premultiply(outbuf, info.W, info.H, stride, info.BitDepth == 16)
+			}
+			return outbuf, nil
 		}
 	}
-	status = C.JxlDecoderProcessInput(d.decoder)
-	if status == C.JXL_DEC_SUCCESS {
-		d.hitEnd = true
-		return nil, nil
-	}
-	for status != C.JXL_DEC_SUCCESS && status != C.JXL_DEC_FULL_IMAGE {
-		if status == C.JXL_DEC_NEED_MORE_INPUT {
-			err = d.nextInput()
-			if err != nil {
-				return nil, err
-			}
-		} else if status == C.JXL_DEC_ERROR {
-			return nil, DecodeDataError
-		} else if status == C.JXL_DEC_FRAME && d.durFrac != 0 {
-			var header C.JxlFrameHeader
-			C.JxlDecoderGetFrameHeader(d.decoder, &header)
-			d.lastFrameDur = time.Duration(header.duration) * d.durFrac
+}
+
+// finish runs the decoder to the end of the image once the last frame has
+// been read, so that no buffer is taken for a frame that never comes.
+func (d *JxlDecoder) finish() error {
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return err
+		}
+		switch ev {
+		case EventSuccess:
+			return nil
+		case EventNeedImageOutBuffer:
+			return d.failed(DecodeDataError)
 		}
-		status = C.JxlDecoderProcessInput(d.decoder)
 	}
-	return outbuf, nil
 }
 
+// setOutBuffer pins buf, since libjxl keeps writing to it after the call
+// returns. It stays pinned until the frame is finished or abandoned.
+func (d *JxlDecoder) setOutBuffer(fmt *C.JxlPixelFormat, buf []byte) C.JxlDecoderStatus {
+	d.pinner.Pin(&buf[0])
+	return C.JxlDecoderSetImageOutBuffer(d.decoder, fmt, unsafe.Pointer(&buf[0]), C.size_t(len(buf)))
+}
+
+func (d *JxlDecoder) onFrame() error {
+	d.loadFrameHeader()
+	d.inFrame = true
+	d.stage = StageFrame
+	d.lastFrameDur = time.Duration(d.header.duration) * d.durFrac
+	if d.frame-d.firstFrame == len(d.durations) {
+		d.durations = append(d.durations, d.lastFrameDur)
+	}
+	if err := d.checkFrame(); err != nil {
+		d.err = d.failed(err)
+	}
+	return d.err
+}
+
+func (d *JxlDecoder) onFullImage() {
+	d.pinner.Unpin()
+	d.inFrame = false
+	d.frame++
+}
+
+// Reset starts decoding a new image from r. A destroyed decoder is created
+// again with the same options; if that fails, it stays closed.
 func (d *JxlDecoder) Reset(r io.Reader) {
-	C.JxlDecoderReleaseInput(d.decoder)
-	C.JxlDecoderReset(d.decoder)
-	d.r = r
+	if d.decoder == nil {
+		if d.create() != nil {
+			d.Destroy()
+			return
+		}
+	} else {
+		C.JxlDecoderReleaseInput(d.decoder)
+		C.JxlDecoderReset(d.decoder)
+	}
+	d.pinner.Unpin()
+	d.boxPinner.Unpin()
+	d.inLen = 0
+	d.setReader(r)
+	d.resetState()
+	d.setup()
+}
+
+func (d *JxlDecoder) resetState() {
+	d.clearBudget()
+	d.left = 0
+	d.pending = 0
 	d.hasInfo = false
+	d.converted = false
+	d.info = JxlInfo{}
+	d.extra = nil
+	d.icc = nil
 	d.hitEnd = false
-	C.JxlDecoderSetParallelRunner(d.decoder, (*[0]byte)(C.JxlResizableParallelRunner), d.runner)
-	C.JxlDecoderSubscribeEvents(d.decoder, C.JXL_DEC_BASIC_INFO|C.JXL_DEC_FULL_IMAGE)
+	d.closed = false
+	d.inFrame = false
+	d.header = C.JxlFrameHeader{}
+	d.stage = StageHeader
+	d.err = nil
+	d.consumed = 0
+	d.pixels = 0
+	d.frame = 0
+	d.firstFrame = 0
+	d.firstTime = 0
+	d.durations = nil
 }
 
-func (d *JxlDecoder) Rewind() {
+func (d *JxlDecoder) Rewind() error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
 	C.JxlDecoderReleaseInput(d.decoder)
 	C.JxlDecoderRewind(d.decoder)
+	d.clearBudget()
+	d.pinner.Unpin()
+	d.boxPinner.Unpin()
+	d.inPinner.Unpin()
+	d.inLen = 0
+	d.left = 0
+	d.pending = 0
 	d.hitEnd = false
+	d.closed = false
 	d.hasInfo = false
-	C.JxlDecoderSubscribeEvents(d.decoder, C.JXL_DEC_BASIC_INFO|C.JXL_DEC_FULL_IMAGE)
+	d.converted = false
+	d.inFrame = false
+	d.stage = StageHeader
+	d.err = nil
+	d.consumed = 0
+	d.pixels = 0
+	d.frame = d.firstFrame
+	d.header = C.JxlFrameHeader{}
+	C.JxlDecoderSubscribeEvents(d.decoder, C.int(d.events))
+	return nil
 }
 
 func Decode(r io.Reader) (image.Image, error) {
-	d := NewJxlDecoder(r)
-	defer d.Destroy()
+	return DecodeWithOptions(r, nil)
+}
+
+func DecodeWithOptions(r io.Reader, opts *DecoderOptions) (image.Image, error) {
+	return DecodeContext(context.Background(), r, opts)
+}
+
+func (d *JxlDecoder) image() (image.Image, error) {
 	info, err := d.Info()
 	if err != nil {
 		return nil, err
@@ -217,18 +633,26 @@ func Decode(r io.Reader) (image.Image, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, sz := pixelFormat(info, d.opts.Align)
+	stride := rowStride(info.W, sz, d.opts.Align)
 	rect := image.Rectangle{Max: image.Point{X: info.W, Y: info.H}}
-	if info.Channels == 1 {
+	if info.CMYK {
+		img := new(image.CMYK)
+		img.Rect = rect
+		img.Stride = stride
+		img.Pix = buf
+		return img, nil
+	} else if info.Channels == 1 {
 		if info.BitDepth == 16 {
 			img := new(image.Gray16)
 			img.Rect = rect
-			img.Stride = 2 * info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		} else {
 			img := new(image.Gray)
 			img.Rect = rect
-			img.Stride = info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		}
@@ -236,13 +660,13 @@ func Decode(r io.Reader) (image.Image, error) {
 		if info.BitDepth == 16 {
 			img := new(image.RGBA64)
 			img.Rect = rect
-			img.Stride = 8 * info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		} else {
 			img := new(image.RGBA)
 			img.Rect = rect
-			img.Stride = 4 * info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		}
@@ -250,13 +674,13 @@ func Decode(r io.Reader) (image.Image, error) {
 		if info.BitDepth == 16 {
 			img := new(image.NRGBA64)
 			img.Rect = rect
-			img.Stride = 8 * info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		} else {
 			img := new(image.NRGBA)
 			img.Rect = rect
-			img.Stride = 4 * info.W
+			img.Stride = stride
 			img.Pix = buf
 			return img, nil
 		}
@@ -264,31 +688,34 @@ func Decode(r io.Reader) (image.Image, error) {
 }
 
 func DecodeConfig(r io.Reader) (image.Config, error) {
-	d := NewJxlDecoder(r)
+	d, err := NewDecoder(r, nil)
+	if err != nil {
+		return image.Config{}, err
+	}
 	defer d.Destroy()
 	info, err := d.Info()
 	if err != nil {
 		return image.Config{}, err
 	}
-	cfg := image.Config{Width: info.W, Height: info.H}
-	if info.Channels == 1 {
+	return image.Config{Width: info.W, Height: info.H, ColorModel: colorModel(info)}, nil
+}
+
+func colorModel(info JxlInfo) color.Model {
+	if info.CMYK {
+		return color.CMYKModel
+	} else if info.Channels == 1 {
 		if info.BitDepth == 16 {
-			cfg.ColorModel = color.Gray16Model
-		} else {
-			cfg.ColorModel = color.GrayModel
+			return color.Gray16Model
 		}
+		return color.GrayModel
 	} else if info.AlphaPremult {
 		if info.BitDepth == 16 {
-			cfg.ColorModel = color.RGBA64Model
-		} else {
-			cfg.ColorModel = color.RGBAModel
-		}
-	} else {
-		if info.BitDepth == 16 {
-			cfg.ColorModel = color.NRGBA64Model
-		} else {
-			cfg.ColorModel = color.NRGBAModel
+			return color.RGBA64Model
 		}
+		return color.RGBAModel
+	}
+	if info.BitDepth == 16 {
+		return color.NRGBA64Model
 	}
-	return cfg, nil
+	return color.NRGBAModel
 }
@@ -1,9 +1,13 @@
 package gojxl_test
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"image"
+	"io"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 
@@ -224,3 +228,133 @@ func TestReset(t *testing.T) {
 		t.Error("crc does not match", DecodeSingleImgHash, h)
 	}
 }
+
+func TestDestroyedDecoder(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	d.Destroy()
+	if err = d.Rewind(); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from Rewind, got", err)
+	}
+	if err = d.SeekFrame(0); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from SeekFrame, got", err)
+	}
+	f.Seek(0, 0)
+	d.Reset(f)
+	defer d.Destroy()
+	n, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == nil {
+		t.Error("expected a frame after Reset")
+	}
+}
+
+func TestDecodeThreads(t *testing.T) {
+	for _, n := range []int{jxl.ThreadsSingle, jxl.ThreadsAuto, 2} {
+		f, err := os.Open(DecodeSingleImgName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jxl.DecodeWithOptions(f, &jxl.DecoderOptions{Threads: n})
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h2, _ := imagehash.DhashHorizontal(img, 8)
+		h := binary.BigEndian.Uint64(h2)
+		if h != DecodeSingleImgHash {
+			t.Error("crc does not match with threads", n, DecodeSingleImgHash, h)
+		}
+	}
+}
+
+func TestNewDecoder(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := jxl.NewDecoder(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Destroy()
+	err = d.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = d.Read()
+	if err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError, got", err)
+	}
+}
+
+func TestDecoderFinalizer(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 4; i++ {
+		d, err := jxl.NewDecoder(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Info()
+	}
+	runtime.GC()
+	runtime.GC()
+}
+
+func TestDecoderErrorHeader(t *testing.T) {
+	d := jxl.NewJxlDecoder(bytes.NewReader(bytes.Repeat([]byte{0x42}, 64)))
+	defer d.Destroy()
+	_, err := d.Info()
+	if !errors.Is(err, jxl.DecodeHeaderError) {
+		t.Fatal("expected DecodeHeaderError, got", err)
+	}
+	var decErr *jxl.DecoderError
+	if !errors.As(err, &decErr) {
+		t.Fatal("expected *DecoderError, got", err)
+	}
+	if decErr.Stage != jxl.StageHeader {
+		t.Error("expected header stage, got", decErr.Stage)
+	}
+	if decErr.BytesRead != 64 {
+		t.Error("expected 64 bytes read, got", decErr.BytesRead)
+	}
+}
+
+func TestDecoderErrorTruncated(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = data[:len(data)/2]
+	d := jxl.NewJxlDecoder(bytes.NewReader(data))
+	defer d.Destroy()
+	_, err = d.Read()
+	if !errors.Is(err, io.EOF) {
+		t.Fatal("expected io.EOF, got", err)
+	}
+	var decErr *jxl.DecoderError
+	if !errors.As(err, &decErr) {
+		t.Fatal("expected *DecoderError, got", err)
+	}
+	if decErr.Stage == jxl.StageHeader {
+		t.Error("expected to fail after the header")
+	}
+	if decErr.BytesRead != int64(len(data)) {
+		t.Errorf("expected %d bytes read, got %d", len(data), decErr.BytesRead)
+	}
+}
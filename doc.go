@@ -0,0 +1,3 @@
+// Package gojxl wraps libjxl for decoding and encoding JPEG XL images. It
+// needs libjxl 0.10 or newer, along with libjxl_cms.
+package gojxl
@@ -1,10 +1,13 @@
 package gojxl
 
 import (
+	"context"
+	"encoding/binary"
 	"image"
 	"image/color"
 	"io"
 	"math"
+	"runtime"
 	"unsafe"
 )
 
@@ -30,47 +33,115 @@ const EncodeClosedError EncodeError = "encoder is closed"
 const EncodeUninitializedError EncodeError = "info not set before writing"
 const EncodeInputError EncodeError = "failed to set input"
 const EncodeDataError EncodeError = "unknown"
+const EncodeAllocError EncodeError = "failed to allocate encoder"
+
+type EncoderOptions struct {
+	// FrameIndexInterval marks every n-th frame as a keyframe in a jxli frame index box.
+	FrameIndexInterval int
+	// Threads is ThreadsAuto, ThreadsSingle, or a fixed number of worker threads.
+	Threads int
+	// Runner, if set, replaces the encoder's own thread pool.
+	Runner *GoRunner
+	// ByteOrder is the order of 16-bit samples passed to Write. It defaults to
+	// binary.BigEndian, the layout of Go's 16-bit image types.
+	ByteOrder binary.ByteOrder
+	// Lossless stores the pixels exactly.
+	Lossless bool
+	// Stride is the distance in bytes between rows of buffers passed to
+	// Write. It must hold at least a whole row, or SetInfo fails. If it is
+	// zero, rows are padded to a multiple of Align bytes, or packed if that is
+	// zero too.
+	Stride int
+	Align  int
+	// ICCProfile, if set, is embedded as the color profile of the image.
+	// SetInfo requires a CMYK profile for the CMYK model.
+	ICCProfile []byte
+	// Alpha declares whether buffers passed to Write have premultiplied
+	// alpha. AlphaAuto takes it from the model passed to SetInfo, so that
+	// only color.RGBAModel and color.RGBA64Model are premultiplied. Encode
+	// always derives it from the image.
+	Alpha AlphaMode
+	// IntensityTarget is the peak luminance of the image in nits. It
+	// defaults to 255, which suits SDR images; HDR sources should set the
+	// real value.
+	IntensityTarget float64
+	// GainMap, if set, is stored in a jhgm box so that HDR displays can
+	// render the image with more headroom. See NewGainMap.
+	GainMap *GainMap
+}
 
 type JxlEncoder struct {
 	encoder     *C.JxlEncoder
+	opts        EncoderOptions
 	runner      unsafe.Pointer
+	cancel      *cancelRunner
 	settings    *C.JxlEncoderFrameSettings
 	x, y        int
 	pxFormat    C.JxlPixelFormat
+	cmyk        bool
+	frames      int
+	err         error
 	closed      bool
 	shouldClose bool
 	w           io.Writer
 }
 
 func NewJxlEncoder(w io.Writer) *JxlEncoder {
-	e := new(JxlEncoder)
-	runner, err := C.JxlResizableParallelRunnerCreate(nil)
-	if runner == nil {
+	return NewJxlEncoderWithOptions(w, nil)
+}
+
+func NewJxlEncoderWithOptions(w io.Writer, opts *EncoderOptions) *JxlEncoder {
+	e, err := NewEncoder(w, opts)
+	if err != nil {
 		panic(err)
 	}
-	e.runner = runner
-	e2, err := C.JxlEncoderCreate(nil)
-	if e2 == nil {
-		panic(err)
+	return e
+}
+
+func NewEncoder(w io.Writer, opts *EncoderOptions) (*JxlEncoder, error) {
+	e := new(JxlEncoder)
+	if opts != nil {
+		e.opts = *opts
+	}
+	runtime.SetFinalizer(e, (*JxlEncoder).free)
+	if e.opts.Runner == nil {
+		runner, ok := newRunner(e.opts.Threads)
+		if !ok {
+			e.free()
+			return nil, EncodeAllocError
+		}
+		e.runner = runner
+	}
+	cancel, err := newCancelRunner(e.opts.Runner, e.runner)
+	if err != nil {
+		e.free()
+		return nil, err
 	}
-	C.JxlEncoderSetParallelRunner(e2, (*[0]byte)(C.JxlResizableParallelRunner), runner)
-	e.encoder = e2
+	e.cancel = cancel
+	e.encoder = C.JxlEncoderCreate(nil)
+	if e.cancel == nil || e.encoder == nil {
+		e.free()
+		return nil, EncodeAllocError
+	}
+	e.cancel.setEncoder(e.encoder)
 	e.w = w
-	return e
+	return e, nil
 }
 
 func (e *JxlEncoder) Destroy() {
-	if !e.closed {
-		var fdata C.JxlFrameHeader
-		C.JxlEncoderSetFrameHeader(e.settings, &fdata)
-		buf := make([]byte, e.x*e.y*int(e.pxFormat.num_channels))
-		e.shouldClose = true
-		e.Write(buf)
+	e.free()
+}
+
+func (e *JxlEncoder) free() {
+	if e.encoder != nil {
+		C.JxlEncoderDestroy(e.encoder)
+		e.encoder = nil
 	}
-	C.JxlEncoderDestroy(e.encoder)
-	C.JxlResizableParallelRunnerDestroy(e.runner)
-    e.encoder = nil
-    e.runner = nil
+	destroyRunner(e.runner)
+	e.runner = nil
+	freeCancelRunner(e.cancel, e.opts.Runner)
+	e.cancel = nil
+	runtime.SetFinalizer(e, nil)
 }
 
 func (e *JxlEncoder) NextIsLast() {
@@ -78,14 +149,30 @@ func (e *JxlEncoder) NextIsLast() {
 }
 
 func (e *JxlEncoder) SetInfo(x, y int, m color.Model, fps float64) bool {
+	if e.closed || e.encoder == nil {
+		e.failed(EncodeClosedError)
+		return false
+	}
+	if x <= 0 || y <= 0 {
+		e.failed(EncodeInfoError)
+		return false
+	}
 	var info C.JxlBasicInfo
 	C.JxlEncoderInitBasicInfo(&info)
 	info.xsize = C.uint32_t(x)
 	info.ysize = C.uint32_t(y)
 	info.intensity_target = 255
+	if e.opts.IntensityTarget > 0 {
+		info.intensity_target = C.float(e.opts.IntensityTarget)
+	}
 	info.intrinsic_xsize = info.xsize
 	info.intrinsic_ysize = info.ysize
+	if e.opts.Lossless {
+		info.uses_original_profile = C.JXL_TRUE
+	}
 	e.x, e.y = x, y
+	e.cmyk = m == color.CMYKModel
+	tuneRunner(e.runner, e.opts.Threads, x, y)
 	switch m {
 	case color.Gray16Model:
 		info.bits_per_sample = 16
@@ -106,6 +193,24 @@ func (e *JxlEncoder) SetInfo(x, y int, m color.Model, fps float64) bool {
 	case color.NRGBAModel:
 		info.alpha_bits = info.bits_per_sample
 		info.num_extra_channels = 1
+	case rgb48Model:
+		info.bits_per_sample = 16
+	case color.CMYKModel:
+		// Without a CMYK profile the file would claim to be sRGB.
+		if len(e.opts.ICCProfile) == 0 {
+			e.failed(EncodeInfoError)
+			return false
+		}
+		// K is an extra channel, and XYB cannot hold CMY.
+		info.num_extra_channels = 1
+		info.uses_original_profile = C.JXL_TRUE
+	}
+	if info.alpha_bits != 0 {
+		premult := e.opts.Alpha.resolve(info.alpha_premultiplied != 0)
+		info.alpha_premultiplied = C.JXL_FALSE
+		if premult {
+			info.alpha_premultiplied = C.JXL_TRUE
+		}
 	}
 	if fps > 0 {
 		info.have_animation = C.JXL_TRUE
@@ -135,32 +240,90 @@ func (e *JxlEncoder) SetInfo(x, y int, m color.Model, fps float64) bool {
 	if info.bits_per_sample == 16 {
 		pxFormat.data_type = C.JXL_TYPE_UINT16
 	}
-	pxFormat.endianness = C.JXL_NATIVE_ENDIAN
+	pxFormat.endianness = endianness(e.opts.ByteOrder)
+	pxFormat.align = C.size_t(e.opts.Align)
+	if e.opts.Stride > 0 {
+		sz := int(pxFormat.num_channels)
+		if e.cmyk {
+			sz = 4
+		} else if pxFormat.data_type == C.JXL_TYPE_UINT16 {
+			sz *= 2
+		}
+		if e.opts.Stride < sz*x {
+			e.failed(EncodeInfoError)
+			return false
+		}
+		pxFormat.align = C.size_t(e.opts.Stride)
+	}
 	e.pxFormat = pxFormat
+	if e.opts.FrameIndexInterval > 0 || e.opts.GainMap != nil {
+		C.JxlEncoderUseContainer(e.encoder, C.JXL_TRUE)
+	}
 	ok := C.JxlEncoderSetBasicInfo(e.encoder, &info)
+	if ok == C.JXL_ENC_SUCCESS && e.cmyk {
+		ok = e.setBlackChannel()
+	}
+	if ok == C.JXL_ENC_SUCCESS && e.opts.GainMap != nil {
+		ok = e.addGainMap()
+	}
+	if ok == C.JXL_ENC_SUCCESS && len(e.opts.ICCProfile) != 0 {
+		ok = C.JxlEncoderSetICCProfile(e.encoder, (*C.uint8_t)(unsafe.Pointer(&e.opts.ICCProfile[0])), C.size_t(len(e.opts.ICCProfile)))
+	}
 	if ok == C.JXL_ENC_SUCCESS {
 		e.settings = C.JxlEncoderFrameSettingsCreate(e.encoder, nil)
 		if e.settings == nil {
+			e.failed(EncodeInfoError)
 			return false
 		}
 		var bDepth C.JxlBitDepth
 		bDepth.bits_per_sample = info.bits_per_sample
 		bDepth._type = C.JXL_BIT_DEPTH_FROM_PIXEL_FORMAT
 		ok = C.JxlEncoderSetFrameBitDepth(e.settings, &bDepth)
+		if ok == C.JXL_ENC_SUCCESS && e.opts.Lossless {
+			ok = C.JxlEncoderSetFrameLossless(e.settings, C.JXL_TRUE)
+		}
 		if ok == C.JXL_ENC_SUCCESS && !e.shouldClose {
 			var fdata C.JxlFrameHeader
 			fdata.duration = 1
 			ok = C.JxlEncoderSetFrameHeader(e.settings, &fdata)
 		}
 	}
-	return ok == C.JXL_ENC_SUCCESS
+	if ok != C.JXL_ENC_SUCCESS {
+		e.failed(EncodeInfoError)
+		return false
+	}
+	return true
+}
+
+func endianness(order binary.ByteOrder) C.JxlEndianness {
+	switch order {
+	case binary.LittleEndian:
+		return C.JXL_LITTLE_ENDIAN
+	case binary.NativeEndian:
+		return C.JXL_NATIVE_ENDIAN
+	}
+	return C.JXL_BIG_ENDIAN
+}
+
+func (e *JxlEncoder) failed(err error) error {
+	code := EncoderOK
+	if e.encoder != nil {
+		code = EncoderStatus(C.JxlEncoderGetError(e.encoder))
+	}
+	e.err = &EncoderError{Code: code, Frame: e.frames, Err: err}
+	return e.err
+}
+
+// Err returns the error that made the last SetInfo, Write or Close fail.
+func (e *JxlEncoder) Err() error {
+	return e.err
 }
 
 func writeHelper(w io.Writer, b []byte) error {
 	n := 0
 	l := len(b)
 	for n < l {
-		n2, err := w.Write(b[n : l-n])
+		n2, err := w.Write(b[n:])
 		if err != nil {
 			return err
 		}
@@ -169,65 +332,107 @@ func writeHelper(w io.Writer, b []byte) error {
 	return nil
 }
 
+// Write adds a frame. Until NextIsLast or Close is called, the frame is kept
+// queued inside libjxl so that it can still be marked as the last one, and
+// its output is only written once the next frame arrives.
 func (e *JxlEncoder) Write(b []byte) error {
 	if e.x == 0 {
-		return EncodeUninitializedError
+		return e.failed(EncodeUninitializedError)
+	}
+	if e.closed || e.encoder == nil {
+		return e.failed(EncodeClosedError)
 	}
-	if e.closed {
-		return EncodeClosedError
+	if len(b) == 0 {
+		return e.failed(EncodeInputError)
+	}
+	if !e.shouldClose {
+		err := e.flush()
+		if err != nil {
+			return err
+		}
+	}
+	if e.opts.FrameIndexInterval > 0 {
+		var key C.int64_t
+		if e.frames%e.opts.FrameIndexInterval == 0 {
+			key = 1
+		}
+		C.JxlEncoderFrameSettingsSetOption(e.settings, C.JXL_ENC_FRAME_INDEX_BOX, key)
+	}
+	var status C.JxlEncoderStatus
+	if e.cmyk {
+		status = e.addCMYKFrame(b)
+	} else {
+		status = C.JxlEncoderAddImageFrame(e.settings, &e.pxFormat, unsafe.Pointer(&b[0]), C.size_t(len(b)))
 	}
-	status := C.JxlEncoderAddImageFrame(e.settings, &e.pxFormat, unsafe.Pointer(&b[0]), C.size_t(len(b)))
 	if status != C.JXL_ENC_SUCCESS {
-		return EncodeInputError
+		return e.failed(EncodeInputError)
 	}
+	e.frames++
 	if e.shouldClose {
 		C.JxlEncoderCloseInput(e.encoder)
 		e.closed = true
+		return e.flush()
 	}
+	return nil
+}
+
+// process runs libjxl until buf is full, unless the current context is done.
+func (e *JxlEncoder) process(buf []byte, sz *C.size_t) C.JxlEncoderStatus {
+	if e.cancel.cancelled() {
+		return C.JXL_ENC_ERROR
+	}
+	return C.encoderProcess(e.encoder, (*C.uchar)(unsafe.Pointer(&buf[0])), sz)
+}
+
+func (e *JxlEncoder) flush() error {
 	buf := make([]byte, block_size)
 	sz := C.size_t(len(buf))
-	status = C.encoderProcess(e.encoder, (*C.uchar)(unsafe.Pointer(&buf[0])), &sz)
+	status := e.process(buf, &sz)
 	for status == C.JXL_ENC_NEED_MORE_OUTPUT {
 		err := writeHelper(e.w, buf[:len(buf)-int(sz)])
 		if err != nil {
-			return err
+			return e.failed(err)
 		}
 		sz = C.size_t(len(buf))
-		status = C.encoderProcess(e.encoder, (*C.uchar)(unsafe.Pointer(&buf[0])), &sz)
+		status = e.process(buf, &sz)
 	}
 	if status == C.JXL_ENC_ERROR {
-		return EncodeDataError
+		return e.failed(EncodeDataError)
 	}
 	err := writeHelper(e.w, buf[:len(buf)-int(sz)])
 	if err != nil {
-		return err
+		return e.failed(err)
 	}
 	return nil
 }
 
+// Close finishes the stream without adding a frame, writes any remaining
+// output and frees the encoder.
+func (e *JxlEncoder) Close() error {
+	err := e.finish()
+	e.free()
+	return err
+}
+
+func (e *JxlEncoder) finish() error {
+	if e.encoder == nil || e.closed || e.x == 0 {
+		return nil
+	}
+	C.JxlEncoderCloseInput(e.encoder)
+	e.closed = true
+	return e.flush()
+}
+
+// Abort frees the encoder without writing anything further.
+func (e *JxlEncoder) Abort() {
+	e.closed = true
+	e.free()
+}
+
 func Encode(w io.Writer, img image.Image) error {
-	var buf []uint8
-	switch i := img.(type) {
-	case *image.Gray:
-		buf = i.Pix
-	case *image.Gray16:
-		buf = i.Pix
-	case *image.NRGBA:
-		buf = i.Pix
-	case *image.NRGBA64:
-		buf = i.Pix
-	case *image.RGBA:
-		buf = i.Pix
-	case *image.RGBA64:
-		buf = i.Pix
-	default:
-		return EncodeUnsupportedError
-	}
-	e := NewJxlEncoder(w)
-	defer e.Destroy()
-	rect := img.Bounds()
-	if !e.SetInfo(rect.Dx(), rect.Dy(), img.ColorModel(), 0) {
-		return EncodeInfoError
-	}
-	return e.Write(buf)
+	return EncodeWithOptions(w, img, nil)
+}
+
+func EncodeWithOptions(w io.Writer, img image.Image, opts *EncoderOptions) error {
+	return EncodeContext(context.Background(), w, img, opts)
 }
@@ -3,6 +3,7 @@ package gojxl_test
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"image"
 	"image/color"
 	_ "image/png"
@@ -48,12 +49,35 @@ func TestEncoderBadBuffer(t *testing.T) {
 	e := jxl.NewJxlEncoder(io.Discard)
 	e.SetInfo(256, 256, color.RGBAModel, 0)
 	err := e.Write(make([]byte, 128))
-	if err != jxl.EncodeInputError {
+	if !errors.Is(err, jxl.EncodeInputError) {
 		t.Error("expected EncodeInputError, got", err)
 	}
+	var encErr *jxl.EncoderError
+	if !errors.As(err, &encErr) {
+		t.Fatal("expected *EncoderError, got", err)
+	}
+	if encErr.Frame != 0 {
+		t.Error("expected frame 0, got", encErr.Frame)
+	}
+	if e.Err() != err {
+		t.Error("expected Err to return the write error, got", e.Err())
+	}
 	e.Destroy()
 }
 
+func TestEncodeEmpty(t *testing.T) {
+	err := jxl.Encode(io.Discard, image.NewGray(image.Rect(0, 0, 0, 8)))
+	if !errors.Is(err, jxl.EncodeInfoError) {
+		t.Error("expected EncodeInfoError, got", err)
+	}
+	e := jxl.NewJxlEncoder(io.Discard)
+	defer e.Destroy()
+	e.SetInfo(8, 8, color.GrayModel, 0)
+	if err := e.Write(nil); !errors.Is(err, jxl.EncodeInputError) {
+		t.Error("expected EncodeInputError, got", err)
+	}
+}
+
 func TestEncoderDoubleWriteOneImage(t *testing.T) {
 	f, err := os.Open(EncodeSingleImageName)
 	if err != nil {
@@ -73,9 +97,12 @@ func TestEncoderDoubleWriteOneImage(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = e.Write(i2.Pix)
-	if err != jxl.EncodeClosedError {
+	if !errors.Is(err, jxl.EncodeClosedError) {
 		t.Error("expected EncodeClosedError, got", err)
 	}
+	if e.Err() != err {
+		t.Error("expected Err to return the write error, got", e.Err())
+	}
 }
 
 func TestEncoderVideo(t *testing.T) {
@@ -125,7 +152,7 @@ func TestEncoderVideo(t *testing.T) {
 	}
 }
 
-func TestEncoderVideoWOFinalize(t *testing.T) {
+func TestEncoderVideoClose(t *testing.T) {
 	f, err := os.Open(EncodeSingleImageName)
 	if err != nil {
 		t.Fatal(err)
@@ -154,19 +181,104 @@ func TestEncoderVideoWOFinalize(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	e.Destroy()
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Close()
+	if err != nil {
+		t.Error("second Close failed:", err)
+	}
 	d := jxl.NewJxlDecoder(buf)
 	defer d.Destroy()
 	d.Read()
-	_, err = d.Read()
+	info, _ := d.Info()
+	b, err := d.Read()
 	if err != nil {
 		t.Fatal(err)
 	}
+	h2, _ := imagehash.DhashHorizontal(&image.RGBA{Rect: image.Rect(0, 0, info.W, info.H), Pix: b, Stride: info.W * 4}, 8)
+	h := binary.BigEndian.Uint64(h2)
+	if h != EncodeVideoHash {
+		t.Error("crc does not match", EncodeVideoHash, h)
+	}
 	n, err := d.Read()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if n == nil {
-		t.Error("expected black frame, got nil")
+	if n != nil {
+		t.Error("expected nil, got extra frame")
+	}
+}
+
+func TestEncoderAbort(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := jxl.NewJxlEncoder(buf)
+	e.SetInfo(16, 16, color.GrayModel, 10)
+	err := e.Write(make([]byte, 16*16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := buf.Len()
+	e.Abort()
+	if buf.Len() != n {
+		t.Error("Abort wrote", buf.Len()-n, "bytes")
+	}
+	err = e.Write(make([]byte, 16*16))
+	if !errors.Is(err, jxl.EncodeClosedError) {
+		t.Error("expected EncodeClosedError, got", err)
+	}
+	if e.SetInfo(16, 16, color.GrayModel, 10) {
+		t.Error("expected SetInfo to fail after Abort")
+	}
+	if !errors.Is(e.Err(), jxl.EncodeClosedError) {
+		t.Error("expected EncodeClosedError from Err, got", e.Err())
+	}
+	e.Destroy()
+}
+
+func TestEncodeThreads(t *testing.T) {
+	f, err := os.Open(EncodeSingleImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	i, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{jxl.ThreadsSingle, 3} {
+		buf := new(bytes.Buffer)
+		err = jxl.EncodeWithOptions(buf, i, &jxl.EncoderOptions{Threads: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i2, err := jxl.Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h2, _ := imagehash.DhashHorizontal(i2, 8)
+		h := binary.BigEndian.Uint64(h2)
+		if h != EncodeSingleImageHash {
+			t.Error("crc does not match with threads", n, EncodeSingleImageHash, h)
+		}
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	e, err := jxl.NewEncoder(io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetInfo(16, 16, color.GrayModel, 0)
+	err = e.Write(make([]byte, 16*16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Destroy()
+	e.Destroy()
+	err = e.Write(make([]byte, 16*16))
+	if !errors.Is(err, jxl.EncodeClosedError) {
+		t.Error("expected EncodeClosedError, got", err)
 	}
 }
@@ -0,0 +1,112 @@
+package gojxl
+
+import "fmt"
+
+type DecodeStage int
+
+const (
+	StageHeader DecodeStage = iota
+	StageColor
+	StageFrame
+	StageBox
+)
+
+func (s DecodeStage) String() string {
+	switch s {
+	case StageHeader:
+		return "header"
+	case StageColor:
+		return "color"
+	case StageFrame:
+		return "frame"
+	case StageBox:
+		return "box"
+	}
+	return "unknown"
+}
+
+// DecoderError describes where decoding failed. Err is a DecodeError, a
+// *LimitError, or the error returned by the underlying io.Reader.
+type DecoderError struct {
+	Stage     DecodeStage
+	Frame     int
+	BytesRead int64
+	Err       error
+}
+
+func (e *DecoderError) Error() string {
+	msg := e.Err.Error()
+	switch e.Err.(type) {
+	case DecodeError, *LimitError:
+	default:
+		msg = "jxl decode error: " + msg
+	}
+	stage := e.Stage.String()
+	if e.Stage == StageFrame {
+		stage = fmt.Sprintf("frame %d", e.Frame)
+	}
+	return fmt.Sprintf("%s (%s, %d bytes read)", msg, stage, e.BytesRead)
+}
+
+func (e *DecoderError) Unwrap() error { return e.Err }
+
+func (d *JxlDecoder) failed(err error) error {
+	if d.memoryExceeded() {
+		err = &LimitError{Limit: "memory", Max: d.opts.Limits.MaxMemory}
+	}
+	return &DecoderError{Stage: d.stage, Frame: d.frame, BytesRead: d.consumed, Err: err}
+}
+
+// EncoderStatus mirrors libjxl's JxlEncoderError codes.
+type EncoderStatus int
+
+const (
+	EncoderOK           EncoderStatus = 0
+	EncoderGeneric      EncoderStatus = 1
+	EncoderOOM          EncoderStatus = 2
+	EncoderJBRD         EncoderStatus = 3
+	EncoderBadInput     EncoderStatus = 4
+	EncoderNotSupported EncoderStatus = 0x80
+	EncoderAPIUsage     EncoderStatus = 0x81
+)
+
+func (s EncoderStatus) String() string {
+	switch s {
+	case EncoderOK:
+		return "ok"
+	case EncoderGeneric:
+		return "generic error"
+	case EncoderOOM:
+		return "out of memory"
+	case EncoderJBRD:
+		return "invalid JPEG reconstruction data"
+	case EncoderBadInput:
+		return "bad input"
+	case EncoderNotSupported:
+		return "not supported"
+	case EncoderAPIUsage:
+		return "API usage error"
+	}
+	return fmt.Sprintf("error %d", int(s))
+}
+
+// EncoderError describes where encoding failed. Err is an EncodeError or
+// the error returned by the underlying io.Writer.
+type EncoderError struct {
+	Code  EncoderStatus
+	Frame int
+	Err   error
+}
+
+func (e *EncoderError) Error() string {
+	msg := e.Err.Error()
+	if _, ok := e.Err.(EncodeError); !ok {
+		msg = "jxl encode error: " + msg
+	}
+	if e.Code == EncoderOK {
+		return fmt.Sprintf("%s (frame %d)", msg, e.Frame)
+	}
+	return fmt.Sprintf("%s (%s, frame %d)", msg, e.Code, e.Frame)
+}
+
+func (e *EncoderError) Unwrap() error { return e.Err }
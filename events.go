@@ -0,0 +1,349 @@
+package gojxl
+
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <stdint.h>
+import "C"
+
+const DecodeEventsError DecodeError = "events must be subscribed before decoding starts"
+
+// Event is a step of libjxl's decoder, as returned by Next. The Event*Info,
+// EventFrame and similar values can be combined for Subscribe; the others
+// report that libjxl is waiting on the caller.
+type Event int
+
+const (
+	// EventNone is returned by Next along with an error.
+	EventNone Event = -1
+	// EventSuccess means the input has been fully decoded.
+	EventSuccess              Event = C.JXL_DEC_SUCCESS
+	EventNeedPreviewOutBuffer Event = C.JXL_DEC_NEED_PREVIEW_OUT_BUFFER
+	EventNeedImageOutBuffer   Event = C.JXL_DEC_NEED_IMAGE_OUT_BUFFER
+	EventJPEGNeedMoreOutput   Event = C.JXL_DEC_JPEG_NEED_MORE_OUTPUT
+	EventBoxNeedMoreOutput    Event = C.JXL_DEC_BOX_NEED_MORE_OUTPUT
+	EventBasicInfo            Event = C.JXL_DEC_BASIC_INFO
+	EventColorEncoding        Event = C.JXL_DEC_COLOR_ENCODING
+	EventPreviewImage         Event = C.JXL_DEC_PREVIEW_IMAGE
+	EventFrame                Event = C.JXL_DEC_FRAME
+	EventFullImage            Event = C.JXL_DEC_FULL_IMAGE
+	EventJPEGReconstruction   Event = C.JXL_DEC_JPEG_RECONSTRUCTION
+	EventBox                  Event = C.JXL_DEC_BOX
+	EventFrameProgression     Event = C.JXL_DEC_FRAME_PROGRESSION
+	EventBoxComplete          Event = C.JXL_DEC_BOX_COMPLETE
+)
+
+// DefaultEvents are the events that Info and Read rely on.
+const DefaultEvents = EventBasicInfo | EventColorEncoding | EventFrame | EventFullImage
+
+var eventNames = map[Event]string{
+	EventNone:                 "none",
+	EventSuccess:              "success",
+	EventNeedPreviewOutBuffer: "need preview out buffer",
+	EventNeedImageOutBuffer:   "need image out buffer",
+	EventJPEGNeedMoreOutput:   "jpeg need more output",
+	EventBoxNeedMoreOutput:    "box need more output",
+	EventBasicInfo:            "basic info",
+	EventColorEncoding:        "color encoding",
+	EventPreviewImage:         "preview image",
+	EventFrame:                "frame",
+	EventFullImage:            "full image",
+	EventJPEGReconstruction:   "jpeg reconstruction",
+	EventBox:                  "box",
+	EventFrameProgression:     "frame progression",
+	EventBoxComplete:          "box complete",
+}
+
+func (e Event) String() string {
+	if name, ok := eventNames[e]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Subscribe replaces the events that Next reports. It must be called before
+// the first call to Next, Info or Read, and holds until the decoder is
+// destroyed. Info and Read need DefaultEvents, and return DecodeEventsError
+// without them.
+func (d *JxlDecoder) Subscribe(events Event) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	if C.JxlDecoderSubscribeEvents(d.decoder, C.int(events)) != C.JXL_DEC_SUCCESS {
+		return DecodeEventsError
+	}
+	d.events = events
+	return nil
+}
+
+// Next runs the decoder until the next subscribed event, reading input as
+// needed. Decoding errors are returned as errors, with EventNone. Once the
+// image is done, Next keeps returning EventSuccess. With EventBox
+// subscribed, the end of the input closes it rather than failing.
+func (d *JxlDecoder) Next() (Event, error) {
+	if d.decoder == nil {
+		return EventNone, DecodeClosedError
+	}
+	if d.err != nil {
+		return EventNone, d.err
+	}
+	if d.hitEnd {
+		return EventSuccess, nil
+	}
+	for {
+		status := d.process()
+		switch status {
+		case C.JXL_DEC_NEED_MORE_INPUT:
+			if d.closed {
+				return EventNone, d.failed(io.ErrUnexpectedEOF)
+			}
+			err := d.nextInput()
+			if errors.Is(err, io.EOF) && d.events&EventBox != 0 {
+				// The last box may run to the end of the input, which
+				// libjxl only knows once the input is closed.
+				C.JxlDecoderCloseInput(d.decoder)
+				d.closed = true
+				continue
+			} else if err != nil {
+				return EventNone, err
+			}
+			continue
+		case C.JXL_DEC_ERROR:
+			if !d.hasInfo {
+				return EventNone, d.failed(DecodeHeaderError)
+			}
+			return EventNone, d.failed(DecodeDataError)
+		}
+		if err := d.onEvent(status); err != nil {
+			return EventNone, err
+		}
+		return Event(status), nil
+	}
+}
+
+// onEvent keeps the decoder's own state in step with libjxl's.
+func (d *JxlDecoder) onEvent(status C.JxlDecoderStatus) error {
+	switch status {
+	case C.JXL_DEC_BASIC_INFO:
+		d.stage = StageColor
+		d.loadInfo()
+		if err := d.checkInfo(d.info); err != nil {
+			d.err = d.failed(err)
+		}
+	case C.JXL_DEC_COLOR_ENCODING:
+		if err := d.setOutputColor(d.info.Channels == 1); err != nil {
+			d.err = d.failed(err)
+			break
+		}
+		d.setBlack()
+		d.hasInfo = true
+		if d.icc == nil {
+			// Rewinding decodes the same image, so the profile is kept.
+			d.icc = d.iccProfile()
+		}
+	case C.JXL_DEC_FRAME:
+		return d.onFrame()
+	case C.JXL_DEC_FULL_IMAGE:
+		d.onFullImage()
+	case C.JXL_DEC_BOX:
+		d.stage = StageBox
+	case C.JXL_DEC_SUCCESS:
+		d.onEnd()
+	}
+	return d.err
+}
+
+// BasicInfo returns the basic info without decoding further. It is valid
+// from EventBasicInfo on.
+func (d *JxlDecoder) BasicInfo() JxlInfo {
+	return d.info
+}
+
+// ColorEncoding returns the color space of the decoded pixels, or nil if
+// it can only be described by an ICC profile. It is valid from
+// EventColorEncoding on.
+func (d *JxlDecoder) ColorEncoding() *ColorEncoding {
+	if d.decoder == nil {
+		return nil
+	}
+	var enc C.JxlColorEncoding
+	if C.JxlDecoderGetColorAsEncodedProfile(d.decoder, C.JXL_COLOR_PROFILE_TARGET_DATA, &enc) != C.JXL_DEC_SUCCESS {
+		return nil
+	}
+	return newColorEncoding(&enc)
+}
+
+// SetOutputColorProfile converts the pixels to enc or, if enc is nil, to
+// the ICC profile icc. It may only be called at EventColorEncoding.
+func (d *JxlDecoder) SetOutputColorProfile(enc *ColorEncoding, icc []byte) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	var status C.JxlDecoderStatus
+	if enc != nil {
+		c := enc.c()
+		status = C.JxlDecoderSetOutputColorProfile(d.decoder, &c, nil, 0)
+	} else if len(icc) != 0 {
+		status = C.JxlDecoderSetOutputColorProfile(d.decoder, nil, (*C.uint8_t)(unsafe.Pointer(&icc[0])), C.size_t(len(icc)))
+	} else {
+		return DecodeColorError
+	}
+	if status != C.JXL_DEC_SUCCESS {
+		return DecodeColorError
+	}
+	d.converted = true
+	d.setBlack()
+	d.icc = d.iccProfile()
+	return nil
+}
+
+// FrameHeader returns the header of the current frame, without pixels. It
+// is valid from EventFrame on.
+func (d *JxlDecoder) FrameHeader() *Layer {
+	if d.decoder == nil {
+		return nil
+	}
+	l := newLayer(d.header, d.frameName, d.durFrac)
+	if bi, ok := d.alphaBlend(); ok {
+		l.AlphaBlend = bi
+	}
+	return l
+}
+
+// ImageOutBufferSize is the size of the buffer SetImageOutBuffer needs, in
+// the layout Read uses. For CMYK images it only holds the C, M and Y
+// samples, inverted, and K must be set with SetExtraChannelBuffer.
+func (d *JxlDecoder) ImageOutBufferSize() (int, error) {
+	if d.decoder == nil {
+		return 0, DecodeClosedError
+	}
+	fmt, _ := pixelFormat(d.BasicInfo(), d.opts.Align)
+	var size C.size_t
+	if C.JxlDecoderImageOutBufferSize(d.decoder, &fmt, &size) != C.JXL_DEC_SUCCESS {
+		return 0, DecodeBufferError
+	}
+	return int(size), nil
+}
+
+// SetImageOutBuffer has the current frame decoded into buf, which must not
+// be touched until EventFullImage.
+func (d *JxlDecoder) SetImageOutBuffer(buf []byte) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	fmt, _ := pixelFormat(d.BasicInfo(), d.opts.Align)
+	if len(buf) == 0 || d.setOutBuffer(&fmt, buf) != C.JXL_DEC_SUCCESS {
+		return DecodeBufferError
+	}
+	return nil
+}
+
+// SetExtraChannelBuffer has extra channel index of the current frame
+// decoded into buf, with samples of the image's bit depth.
+func (d *JxlDecoder) SetExtraChannelBuffer(index int, buf []byte) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	var fmt C.JxlPixelFormat
+	fmt.num_channels = 1
+	fmt.endianness = C.JXL_BIG_ENDIAN
+	fmt.data_type = C.JXL_TYPE_UINT8
+	if d.BasicInfo().BitDepth == 16 {
+		fmt.data_type = C.JXL_TYPE_UINT16
+	}
+	if len(buf) == 0 {
+		return DecodeBufferError
+	}
+	d.pinner.Pin(&buf[0])
+	if C.JxlDecoderSetExtraChannelBuffer(d.decoder, &fmt, unsafe.Pointer(&buf[0]), C.size_t(len(buf)), C.uint32_t(index)) != C.JXL_DEC_SUCCESS {
+		return DecodeBufferError
+	}
+	return nil
+}
+
+// SkipCurrentFrame skips the pixels of the current frame. It is valid at
+// EventNeedImageOutBuffer.
+func (d *JxlDecoder) SkipCurrentFrame() error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	if C.JxlDecoderSkipCurrentFrame(d.decoder) != C.JXL_DEC_SUCCESS {
+		return d.failed(DecodeDataError)
+	}
+	d.onFullImage()
+	return nil
+}
+
+func (d *JxlDecoder) SetDecompressBoxes(decompress bool) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	v := C.JXL_BOOL(C.JXL_FALSE)
+	if decompress {
+		v = C.JXL_TRUE
+	}
+	if C.JxlDecoderSetDecompressBoxes(d.decoder, v) != C.JXL_DEC_SUCCESS {
+		return DecodeEventsError
+	}
+	return nil
+}
+
+// BoxType returns the type of the current box, or that of its contents if
+// it is compressed and decompressed is set. It is valid at EventBox.
+func (d *JxlDecoder) BoxType(decompressed bool) string {
+	if d.decoder == nil {
+		return ""
+	}
+	var typ C.JxlBoxType
+	v := C.JXL_BOOL(C.JXL_FALSE)
+	if decompressed {
+		v = C.JXL_TRUE
+	}
+	C.JxlDecoderGetBoxType(d.decoder, &typ[0], v)
+	return C.GoStringN(&typ[0], 4)
+}
+
+// BoxSize returns the size of the contents of the current box, or -1 if
+// it runs to the end of the input.
+func (d *JxlDecoder) BoxSize() int64 {
+	if d.decoder == nil {
+		return -1
+	}
+	var size C.uint64_t
+	if C.JxlDecoderGetBoxSizeContents(d.decoder, &size) != C.JXL_DEC_SUCCESS {
+		return -1
+	}
+	return int64(size)
+}
+
+// SetBoxBuffer has the contents of the current box written to buf. At
+// EventBoxNeedMoreOutput, release it and set a larger one.
+func (d *JxlDecoder) SetBoxBuffer(buf []byte) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	if len(buf) == 0 {
+		return DecodeBufferError
+	}
+	d.boxPinner.Pin(&buf[0])
+	if C.JxlDecoderSetBoxBuffer(d.decoder, (*C.uint8_t)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))) != C.JXL_DEC_SUCCESS {
+		d.boxPinner.Unpin()
+		return DecodeBufferError
+	}
+	return nil
+}
+
+// ReleaseBoxBuffer takes back the buffer given to SetBoxBuffer and returns
+// how many bytes at its end were not written.
+func (d *JxlDecoder) ReleaseBoxBuffer() int {
+	if d.decoder == nil {
+		return 0
+	}
+	n := int(C.JxlDecoderReleaseBoxBuffer(d.decoder))
+	d.boxPinner.Unpin()
+	return n
+}
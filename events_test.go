@@ -0,0 +1,179 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestNextEvents(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := jxl.NewJxlDecoderFromBytes(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Destroy()
+	wantPix, err := want.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := jxl.NewJxlDecoder(bytes.NewReader(data))
+	defer d.Destroy()
+	var events []jxl.Event
+	var pix []byte
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+		if ev == jxl.EventSuccess {
+			break
+		}
+		switch ev {
+		case jxl.EventBasicInfo:
+			if info := d.BasicInfo(); info.W == 0 || info.H == 0 {
+				t.Error("expected a size at basic info, got", info)
+			}
+		case jxl.EventColorEncoding:
+			if d.ColorEncoding() == nil {
+				t.Error("expected a color encoding")
+			}
+		case jxl.EventFrame:
+			if h := d.FrameHeader(); !h.Last {
+				t.Error("expected the only frame to be the last")
+			}
+		case jxl.EventNeedImageOutBuffer:
+			n, err := d.ImageOutBufferSize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pix = make([]byte, n)
+			if err = d.SetImageOutBuffer(pix); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	seq := []jxl.Event{jxl.EventBasicInfo, jxl.EventColorEncoding, jxl.EventFrame, jxl.EventNeedImageOutBuffer, jxl.EventFullImage, jxl.EventSuccess}
+	if len(events) != len(seq) {
+		t.Fatal("unexpected events", events)
+	}
+	for i := range seq {
+		if events[i] != seq[i] {
+			t.Fatal("unexpected events", events)
+		}
+	}
+	if !bytes.Equal(pix, wantPix) {
+		t.Error("pixels differ from Read")
+	}
+	ev, err := d.Next()
+	if ev != jxl.EventSuccess || err != nil {
+		t.Error("expected success after the end, got", ev, err)
+	}
+}
+
+func TestSubscribeBoxes(t *testing.T) {
+	gain := image.NewGray(image.Rect(0, 0, 8, 8))
+	gm, err := jxl.NewGainMap(gain, &jxl.GainMapMetadata{AlternateHeadroom: 1, Gamma: [3]float64{1, 1, 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeWithOptions(buf, gain, &jxl.EncoderOptions{GainMap: gm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Streamed, so Next must close the input for libjxl to finish the last box.
+	d, err := jxl.NewDecoder(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	err = d.Subscribe(jxl.EventBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev == jxl.EventSuccess {
+			break
+		}
+		if ev == jxl.EventBox && d.BoxType(true) == "jhgm" {
+			found = d.BoxSize() > 0
+		}
+	}
+	if !found {
+		t.Error("expected a jhgm box")
+	}
+	if err = d.Subscribe(jxl.DefaultEvents); err != jxl.DecodeEventsError {
+		t.Error("expected DecodeEventsError once decoding started, got", err)
+	}
+}
+
+func TestInfoNeedsDefaultEvents(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := jxl.NewDecoder(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	err = d.Subscribe(jxl.EventBasicInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Info(); err != jxl.DecodeEventsError {
+		t.Error("expected DecodeEventsError, got", err)
+	}
+	if _, err = d.Read(); err != jxl.DecodeEventsError {
+		t.Error("expected DecodeEventsError from Read, got", err)
+	}
+}
+
+func TestEventsAfterDestroy(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := jxl.NewDecoder(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Destroy()
+	ev, err := d.Next()
+	if ev != jxl.EventNone || err != jxl.DecodeClosedError {
+		t.Error("expected EventNone and DecodeClosedError, got", ev, err)
+	}
+	if d.ColorEncoding() != nil || d.FrameHeader() != nil {
+		t.Error("expected nil getters on a destroyed decoder")
+	}
+	if _, err = d.ImageOutBufferSize(); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from ImageOutBufferSize, got", err)
+	}
+	if err = d.SetImageOutBuffer(make([]byte, 4)); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from SetImageOutBuffer, got", err)
+	}
+	if err = d.SkipCurrentFrame(); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from SkipCurrentFrame, got", err)
+	}
+	if err = d.SetBoxBuffer(make([]byte, 4)); err != jxl.DecodeClosedError {
+		t.Error("expected DecodeClosedError from SetBoxBuffer, got", err)
+	}
+	if d.BoxType(false) != "" || d.BoxSize() != -1 || d.ReleaseBoxBuffer() != 0 {
+		t.Error("expected zero box getters on a destroyed decoder")
+	}
+}
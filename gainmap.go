@@ -0,0 +1,353 @@
+package gojxl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// #include <jxl/encode.h>
+import "C"
+
+const DecodeGainMapError DecodeError = "invalid gain map"
+
+// GainMap is the contents of a jhgm box, which lets an SDR image be rendered
+// in HDR, as described by ISO 21496-1.
+type GainMap struct {
+	Version byte
+	// Metadata is the ISO 21496-1 binary metadata, see ParseGainMapMetadata.
+	Metadata []byte
+	// Color is the color space in which the gain map is applied, or nil if
+	// it is that of the base image.
+	Color *ColorEncoding
+	// AltICC is the ICC profile of the alternate rendition, as stored in
+	// the box.
+	AltICC []byte
+	// Codestream is the gain map image, a bare JPEG XL codestream.
+	Codestream []byte
+}
+
+// GainMapMetadata holds the parameters of ISO 21496-1. Headrooms and the
+// gain range are in stops, that is log2 of a luminance ratio. The per
+// channel fields repeat the same value if the gain map is not per channel.
+type GainMapMetadata struct {
+	BaseHeadroom      float64
+	AlternateHeadroom float64
+	// BaseColorSpace means the gain map is applied in the color space of
+	// the base image rather than that of the alternate rendition.
+	BaseColorSpace  bool
+	Min, Max        [3]float64
+	Gamma           [3]float64
+	BaseOffset      [3]float64
+	AlternateOffset [3]float64
+}
+
+const (
+	gainMapMultiChannel   = 0x80
+	gainMapBaseColorSpace = 0x40
+	gainMapCommonDenom    = 0x08
+	gainMapDenominator    = 1000000
+)
+
+func ParseGainMapMetadata(b []byte) (*GainMapMetadata, error) {
+	r := bytes.NewReader(b)
+	var head struct {
+		MinVersion, WriterVersion uint16
+		Flags                     uint8
+	}
+	if err := binary.Read(r, binary.BigEndian, &head); err != nil || head.MinVersion != 0 {
+		return nil, DecodeGainMapError
+	}
+	channels := 1
+	if head.Flags&gainMapMultiChannel != 0 {
+		channels = 3
+	}
+	// Every value is a fraction. With a common denominator, it is stored
+	// once up front and only numerators follow.
+	var common uint32
+	if head.Flags&gainMapCommonDenom != 0 {
+		if binary.Read(r, binary.BigEndian, &common) != nil || common == 0 {
+			return nil, DecodeGainMapError
+		}
+	}
+	var err error
+	next := func(signed bool) float64 {
+		var n, d uint32
+		if err == nil {
+			err = binary.Read(r, binary.BigEndian, &n)
+		}
+		d = common
+		if err == nil && common == 0 {
+			err = binary.Read(r, binary.BigEndian, &d)
+		}
+		if err != nil || d == 0 {
+			err = DecodeGainMapError
+			return 0
+		}
+		if signed {
+			return float64(int32(n)) / float64(d)
+		}
+		return float64(n) / float64(d)
+	}
+	m := new(GainMapMetadata)
+	m.BaseColorSpace = head.Flags&gainMapBaseColorSpace != 0
+	m.BaseHeadroom = next(false)
+	m.AlternateHeadroom = next(false)
+	for c := 0; c < channels; c++ {
+		m.Min[c] = next(true)
+		m.Max[c] = next(true)
+		m.Gamma[c] = next(false)
+		m.BaseOffset[c] = next(true)
+		m.AlternateOffset[c] = next(true)
+	}
+	if err != nil || m.Gamma[0] == 0 {
+		return nil, DecodeGainMapError
+	}
+	for c := channels; c < 3; c++ {
+		m.Min[c], m.Max[c], m.Gamma[c] = m.Min[0], m.Max[0], m.Gamma[0]
+		m.BaseOffset[c], m.AlternateOffset[c] = m.BaseOffset[0], m.AlternateOffset[0]
+	}
+	return m, nil
+}
+
+// MarshalBinary encodes the metadata in the ISO 21496-1 binary format.
+func (m *GainMapMetadata) MarshalBinary() ([]byte, error) {
+	channels := 3
+	var flags uint8 = gainMapMultiChannel
+	if m.Min[0] == m.Min[1] && m.Min[0] == m.Min[2] && m.Max[0] == m.Max[1] && m.Max[0] == m.Max[2] &&
+		m.Gamma[0] == m.Gamma[1] && m.Gamma[0] == m.Gamma[2] &&
+		m.BaseOffset[0] == m.BaseOffset[1] && m.BaseOffset[0] == m.BaseOffset[2] &&
+		m.AlternateOffset[0] == m.AlternateOffset[1] && m.AlternateOffset[0] == m.AlternateOffset[2] {
+		channels, flags = 1, 0
+	}
+	if m.BaseColorSpace {
+		flags |= gainMapBaseColorSpace
+	}
+	buf := binary.BigEndian.AppendUint16(nil, 0)
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+	buf = append(buf, flags)
+	var err error
+	put := func(f float64, signed bool) {
+		f = math.Round(f * gainMapDenominator)
+		if signed && (f < math.MinInt32 || f > math.MaxInt32) || !signed && (f < 0 || f > math.MaxUint32) {
+			err = EncodeInfoError
+		}
+		n := uint32(f)
+		if signed {
+			n = uint32(int32(f))
+		}
+		buf = binary.BigEndian.AppendUint32(buf, n)
+		buf = binary.BigEndian.AppendUint32(buf, gainMapDenominator)
+	}
+	put(m.BaseHeadroom, false)
+	put(m.AlternateHeadroom, false)
+	for c := 0; c < channels; c++ {
+		put(m.Min[c], true)
+		put(m.Max[c], true)
+		put(m.Gamma[c], false)
+		put(m.BaseOffset[c], true)
+		put(m.AlternateOffset[c], true)
+	}
+	return buf, err
+}
+
+// parseGainMap reads a jhgm box: a version byte, the metadata with a 16-bit
+// size, the color encoding with an 8-bit size, the alternate ICC profile
+// with a 32-bit size, and the codestream up to the end. The parts of b are
+// handed out as they are.
+func parseGainMap(b []byte) (*GainMap, error) {
+	if len(b) < 3 {
+		return nil, DecodeGainMapError
+	}
+	g := &GainMap{Version: b[0]}
+	n := int(binary.BigEndian.Uint16(b[1:]))
+	b = b[3:]
+	if len(b) < n+1 {
+		return nil, DecodeGainMapError
+	}
+	g.Metadata, b = b[:n:n], b[n:]
+	n = int(b[0])
+	b = b[1:]
+	if len(b) < n+4 {
+		return nil, DecodeGainMapError
+	}
+	if n != 0 {
+		g.Color = readColorEncoding(b[:n])
+		if g.Color == nil {
+			return nil, DecodeGainMapError
+		}
+	}
+	b = b[n:]
+	n = int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if n < 0 || len(b) < n {
+		return nil, DecodeGainMapError
+	}
+	if n != 0 {
+		g.AltICC = b[:n:n]
+	}
+	g.Codestream = b[n:]
+	if len(g.Metadata) == 0 {
+		g.Metadata = nil
+	}
+	return g, nil
+}
+
+// bundle serializes g as the contents of a jhgm box.
+func (g *GainMap) bundle() ([]byte, bool) {
+	if len(g.Metadata) > math.MaxUint16 || uint64(len(g.AltICC)) > math.MaxUint32 || len(g.Codestream) == 0 {
+		return nil, false
+	}
+	var color []byte
+	if g.Color != nil {
+		color = appendColorEncoding(nil, g.Color)
+		if color == nil || len(color) > math.MaxUint8 {
+			return nil, false
+		}
+	}
+	buf := []byte{g.Version}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(g.Metadata)))
+	buf = append(buf, g.Metadata...)
+	buf = append(buf, byte(len(color)))
+	buf = append(buf, color...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(g.AltICC)))
+	buf = append(buf, g.AltICC...)
+	return append(buf, g.Codestream...), true
+}
+
+// NewGainMap encodes img as a gain map with the given metadata, ready to be
+// set as EncoderOptions.GainMap.
+func NewGainMap(img image.Image, meta *GainMapMetadata, opts *EncoderOptions) (*GainMap, error) {
+	md, err := meta.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	// The gain map must be a bare codestream.
+	var o EncoderOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.FrameIndexInterval, o.GainMap = 0, nil
+	buf := new(bytes.Buffer)
+	err = EncodeWithOptions(buf, img, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &GainMap{Metadata: md, Codestream: buf.Bytes()}, nil
+}
+
+// ReadGainMap returns the gain map of the image read from r, or nil if it
+// has none.
+func ReadGainMap(r io.Reader) (*GainMap, error) {
+	d, err := NewDecoder(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Destroy()
+	if err = d.Subscribe(EventBox); err != nil {
+		return nil, err
+	}
+	if err = d.SetDecompressBoxes(true); err != nil {
+		return nil, err
+	}
+	var box []byte
+	used := -1
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch ev {
+		case EventBoxNeedMoreOutput:
+			used = len(box) - d.ReleaseBoxBuffer()
+			box = append(box[:used], make([]byte, len(box))...)
+			d.SetBoxBuffer(box[used:])
+		case EventBox, EventSuccess:
+			if used >= 0 {
+				used = len(box) - d.ReleaseBoxBuffer()
+				g, err := parseGainMap(box[:used])
+				if err != nil {
+					return nil, d.failed(err)
+				}
+				return g, nil
+			}
+			if ev == EventSuccess {
+				return nil, nil
+			}
+			if d.BoxType(true) == "jhgm" {
+				box = make([]byte, block_size)
+				used = 0
+				d.SetBoxBuffer(box)
+			}
+		}
+	}
+}
+
+// LinearImage holds linear light RGB samples, where 1 is SDR white.
+type LinearImage struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+// Apply renders base, which must be sRGB, for a display that has headroom
+// stops above SDR white. Decode the base image with ColorSRGB to get one.
+// Color and AltICC are not taken into account, so the result is in linear
+// sRGB.
+func (g *GainMap) Apply(base image.Image, headroom float64) (*LinearImage, error) {
+	meta, err := ParseGainMapMetadata(g.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	gm, err := DecodeBytes(g.Codestream)
+	if err != nil {
+		return nil, err
+	}
+	weight := 0.0
+	if span := meta.AlternateHeadroom - meta.BaseHeadroom; span != 0 {
+		weight = math.Max(0, math.Min(1, (headroom-meta.BaseHeadroom)/span))
+	} else if headroom >= meta.AlternateHeadroom {
+		weight = 1
+	}
+	rect := base.Bounds()
+	gr := gm.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	out := &LinearImage{Pix: make([]float32, 3*w*h), Stride: 3 * w, Rect: rect}
+	for y := 0; y < h; y++ {
+		gy := gr.Min.Y + y*gr.Dy()/h
+		for x := 0; x < w; x++ {
+			gx := gr.Min.X + x*gr.Dx()/w
+			px := color.NRGBA64Model.Convert(base.At(rect.Min.X+x, rect.Min.Y+y)).(color.NRGBA64)
+			gain := color.NRGBA64Model.Convert(gm.At(gx, gy)).(color.NRGBA64)
+			for c, v := range [3]uint16{px.R, px.G, px.B} {
+				gv := float64([3]uint16{gain.R, gain.G, gain.B}[c]) / 0xffff
+				gv = math.Pow(gv, 1/meta.Gamma[c])
+				boost := meta.Min[c]*(1-gv) + meta.Max[c]*gv
+				lin := srgbToLinear(float64(v) / 0xffff)
+				lin = (lin+meta.BaseOffset[c])*math.Exp2(boost*weight) - meta.AlternateOffset[c]
+				out.Pix[y*out.Stride+3*x+c] = float32(lin)
+			}
+		}
+	}
+	return out, nil
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func (e *JxlEncoder) addGainMap() C.JxlEncoderStatus {
+	box, ok := e.opts.GainMap.bundle()
+	if !ok || C.JxlEncoderUseBoxes(e.encoder) != C.JXL_ENC_SUCCESS {
+		return C.JXL_ENC_ERROR
+	}
+	typ := C.JxlBoxType{'j', 'h', 'g', 'm'}
+	return C.JxlEncoderAddBox(e.encoder, &typ[0], (*C.uint8_t)(unsafe.Pointer(&box[0])), C.size_t(len(box)), C.JXL_FALSE)
+}
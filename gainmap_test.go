@@ -0,0 +1,144 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestGainMapMetadata(t *testing.T) {
+	m := &jxl.GainMapMetadata{
+		AlternateHeadroom: 2.5,
+		Min:               [3]float64{-0.5, -0.5, -0.25},
+		Max:               [3]float64{2, 2.5, 3},
+		Gamma:             [3]float64{1, 1, 1},
+		BaseOffset:        [3]float64{1.0 / 64, 1.0 / 64, 1.0 / 64},
+		AlternateOffset:   [3]float64{1.0 / 64, 1.0 / 64, 1.0 / 64},
+	}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jxl.ParseGainMapMetadata(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AlternateHeadroom != m.AlternateHeadroom || got.Min != m.Min || got.Max != m.Max {
+		t.Errorf("metadata differs after round trip: %+v", got)
+	}
+	for c := 0; c < 3; c++ {
+		if math.Abs(got.BaseOffset[c]-m.BaseOffset[c]) > 1e-6 {
+			t.Errorf("base offset %d: got %v", c, got.BaseOffset[c])
+		}
+	}
+	if _, err = jxl.ParseGainMapMetadata(b[:len(b)-1]); err == nil {
+		t.Error("expected an error for truncated metadata")
+	}
+}
+
+func TestGainMapRoundTrip(t *testing.T) {
+	base := loadEncodeInput(t)
+	gain := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range gain.Pix {
+		gain.Pix[i] = 255
+	}
+	meta := &jxl.GainMapMetadata{AlternateHeadroom: 1, Max: [3]float64{1, 1, 1}, Gamma: [3]float64{1, 1, 1}}
+	gm, err := jxl.NewGainMap(gain, meta, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeWithOptions(buf, base, &jxl.EncoderOptions{GainMap: gm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jxl.ReadGainMap(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("gain map not found")
+	}
+	if !bytes.Equal(got.Metadata, gm.Metadata) || !bytes.Equal(got.Codestream, gm.Codestream) {
+		t.Fatal("gain map differs after round trip")
+	}
+	img, err := jxl.DecodeWithOptions(buf, &jxl.DecoderOptions{Color: jxl.ColorSRGB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdr, err := got.Apply(img, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := got.Apply(img, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A full gain of one stop doubles every sample at a headroom of one stop.
+	for i, v := range sdr.Pix {
+		if math.Abs(float64(hdr.Pix[i]-2*v)) > 1e-4 {
+			t.Fatalf("sample %d: got %v, want %v", i, hdr.Pix[i], 2*v)
+		}
+	}
+	r, _, _, _ := img.At(0, 0).RGBA()
+	want := math.Pow((float64(r)/0xffff+0.055)/1.055, 2.4)
+	if float64(r)/0xffff <= 0.04045 {
+		want = float64(r) / 0xffff / 12.92
+	}
+	if math.Abs(float64(sdr.Pix[0])-want) > 1e-3 {
+		t.Error("expected the base image at no headroom, got", sdr.Pix[0], want)
+	}
+}
+
+func TestGainMapColorEncoding(t *testing.T) {
+	gm, err := jxl.NewGainMap(image.NewGray(image.Rect(0, 0, 8, 8)), &jxl.GainMapMetadata{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm.Color = &jxl.ColorEncoding{
+		ColorSpace:      0,
+		WhitePoint:      2,
+		WhitePointXY:    [2]float64{0.3127, 0.329},
+		Primaries:       2,
+		RedXY:           [2]float64{0.708, 0.292},
+		GreenXY:         [2]float64{0.17, 0.797},
+		BlueXY:          [2]float64{0.131, -0.046},
+		Transfer:        65535,
+		Gamma:           0.4545455,
+		RenderingIntent: 0,
+	}
+	gm.AltICC = []byte{1, 2, 3}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeWithOptions(buf, image.NewGray(image.Rect(0, 0, 8, 8)), &jxl.EncoderOptions{GainMap: gm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jxl.ReadGainMap(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Color == nil {
+		t.Fatal("color encoding lost")
+	}
+	if *got.Color != *gm.Color {
+		t.Errorf("got %+v, want %+v", *got.Color, *gm.Color)
+	}
+	if !bytes.Equal(got.AltICC, gm.AltICC) {
+		t.Error("alternate ICC profile differs after round trip")
+	}
+}
+
+func TestReadGainMapAbsent(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := jxl.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := jxl.ReadGainMap(buf)
+	if g != nil || err != nil {
+		t.Error("expected no gain map, got", g, err)
+	}
+}
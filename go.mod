@@ -1,6 +1,6 @@
 module github.com/jlortiz0/go-jxl-decoder
 
-go 1.19
+go 1.21
 
 require github.com/devedge/imagehash v0.0.0-20180324030135-7061aa3b4066
 
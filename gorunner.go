@@ -0,0 +1,145 @@
+package gojxl
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <jxl/encode.h>
+// #include <jxl/parallel_runner.h>
+// #include <stdint.h>
+// extern JxlParallelRetCode goJxlRunner(void*, void*, JxlParallelRunInit, JxlParallelRunFunction, uint32_t, uint32_t);
+// static inline void *jxlHandlePtr(uintptr_t h) { return (void *)h; }
+// static inline JxlParallelRetCode jxlCallInit(JxlParallelRunInit f, void *opaque, size_t n) {
+//     return f(opaque, n);
+// }
+// static inline void jxlCallRun(JxlParallelRunFunction f, void *opaque, uint32_t value, size_t thread) {
+//     f(opaque, value, thread);
+// }
+import "C"
+
+type RunnerError string
+
+func (e RunnerError) Error() string { return "jxl runner error: " + string(e) }
+
+const RunnerBusyError RunnerError = "runner is still in use"
+const RunnerClosedError RunnerError = "runner is closed"
+
+// runners maps the ids passed to libjxl back to their GoRunners. Unlike a
+// cgo.Handle, an id that is no longer there is not fatal.
+var (
+	runners  sync.Map
+	runnerID atomic.Uintptr
+)
+
+// GoRunner runs libjxl's parallel work on goroutines. A single GoRunner can
+// be shared by any number of decoders and encoders, and the number of
+// goroutines it adds on top of the calling ones never exceeds its size.
+type GoRunner struct {
+	sem chan struct{}
+	id  uintptr
+
+	mu     sync.Mutex
+	users  int
+	closed bool
+}
+
+func NewGoRunner(workers int) *GoRunner {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	r := &GoRunner{sem: make(chan struct{}, workers), id: runnerID.Add(1)}
+	runners.Store(r.id, r)
+	return r
+}
+
+// Close releases the runner. It fails with RunnerBusyError while a decoder
+// or encoder that uses it has not been destroyed.
+func (r *GoRunner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users != 0 {
+		return RunnerBusyError
+	}
+	if !r.closed {
+		r.closed = true
+		runners.Delete(r.id)
+	}
+	return nil
+}
+
+// attach counts a codec that uses r until the matching detach.
+func (r *GoRunner) attach() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return RunnerClosedError
+	}
+	r.users++
+	return nil
+}
+
+func (r *GoRunner) detach() {
+	r.mu.Lock()
+	r.users--
+	r.mu.Unlock()
+}
+
+func (r *GoRunner) opaque() unsafe.Pointer {
+	return C.jxlHandlePtr(C.uintptr_t(r.id))
+}
+
+func (r *GoRunner) run(opaque unsafe.Pointer, init C.JxlParallelRunInit, fn C.JxlParallelRunFunction, start, end uint32) C.JxlParallelRetCode {
+	count := end - start
+	if count == 0 {
+		return 0
+	}
+	threads := uint32(cap(r.sem)) + 1
+	if threads > count {
+		threads = count
+	}
+	ret := C.jxlCallInit(init, opaque, C.size_t(threads))
+	if ret != 0 {
+		return ret
+	}
+	var next uint32
+	work := func(thread C.size_t) {
+		for {
+			v := atomic.AddUint32(&next, 1) - 1
+			if v >= count {
+				return
+			}
+			C.jxlCallRun(fn, opaque, C.uint32_t(start+v), thread)
+		}
+	}
+	var wg sync.WaitGroup
+spawn:
+	for t := uint32(1); t < threads; t++ {
+		select {
+		case r.sem <- struct{}{}:
+		default:
+			break spawn
+		}
+		wg.Add(1)
+		go func(thread C.size_t) {
+			work(thread)
+			<-r.sem
+			wg.Done()
+		}(C.size_t(t))
+	}
+	work(0)
+	wg.Wait()
+	return 0
+}
+
+//export goJxlRunner
+func goJxlRunner(runnerOpaque, jpegxlOpaque unsafe.Pointer, init C.JxlParallelRunInit, fn C.JxlParallelRunFunction, start, end C.uint32_t) C.JxlParallelRetCode {
+	r, ok := runners.Load(uintptr(runnerOpaque))
+	if !ok {
+		return C.JXL_PARALLEL_RET_RUNNER_ERROR
+	}
+	return r.(*GoRunner).run(jpegxlOpaque, init, fn, uint32(start), uint32(end))
+}
@@ -0,0 +1,96 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/devedge/imagehash"
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestGoRunnerDecode(t *testing.T) {
+	r := jxl.NewGoRunner(2)
+	defer r.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := os.Open(DecodeSingleImgName)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			img, err := jxl.DecodeWithOptions(f, &jxl.DecoderOptions{Runner: r})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			h2, _ := imagehash.DhashHorizontal(img, 8)
+			h := binary.BigEndian.Uint64(h2)
+			if h != DecodeSingleImgHash {
+				t.Error("crc does not match", DecodeSingleImgHash, h)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGoRunnerEncode(t *testing.T) {
+	r := jxl.NewGoRunner(0)
+	defer r.Close()
+	f, err := os.Open(EncodeSingleImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	i, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeWithOptions(buf, i, &jxl.EncoderOptions{Runner: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err = jxl.DecodeWithOptions(buf, &jxl.DecoderOptions{Runner: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := imagehash.DhashHorizontal(i, 8)
+	h := binary.BigEndian.Uint64(h2)
+	if h != EncodeSingleImageHash {
+		t.Error("crc does not match", EncodeSingleImageHash, h)
+	}
+}
+
+func TestGoRunnerCloseInUse(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := jxl.NewGoRunner(2)
+	d, err := jxl.NewJxlDecoderFromBytes(data, &jxl.DecoderOptions{Runner: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != jxl.RunnerBusyError {
+		t.Fatal("expected RunnerBusyError, got", err)
+	}
+	if _, err := d.Read(); err != nil {
+		t.Fatal(err)
+	}
+	d.Destroy()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = jxl.NewJxlDecoderFromBytes(data, &jxl.DecoderOptions{Runner: r})
+	if err != jxl.RunnerClosedError {
+		t.Error("expected RunnerClosedError, got", err)
+	}
+}
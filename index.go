@@ -0,0 +1,274 @@
+package gojxl
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const containerHeader = "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"
+
+const DecodeContainerError DecodeError = "invalid container"
+const DecodeIndexError DecodeError = "invalid frame index"
+
+type FrameIndexEntry struct {
+	Offset int64
+	Time   time.Duration
+	Frame  int
+}
+
+type FrameIndex struct {
+	TPSNumerator, TPSDenominator uint32
+	Entries                      []FrameIndexEntry
+}
+
+type box struct {
+	typ       string
+	off, size int64
+}
+
+type segment struct {
+	pos, off, size int64
+}
+
+func readBoxes(r io.ReaderAt, size int64) ([]box, error) {
+	var boxes []box
+	var hdr [16]byte
+	pos := int64(0)
+	for pos < size {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			return nil, DecodeContainerError
+		}
+		b := box{typ: string(hdr[4:8]), off: pos + 8}
+		b.size = int64(binary.BigEndian.Uint32(hdr[:4]))
+		switch b.size {
+		case 0:
+			b.size = size - pos
+		case 1:
+			if _, err := r.ReadAt(hdr[8:], pos+8); err != nil {
+				return nil, DecodeContainerError
+			}
+			b.size = int64(binary.BigEndian.Uint64(hdr[8:]))
+			b.off += 8
+		}
+		hdrLen := b.off - pos
+		if b.size < hdrLen || pos+b.size > size {
+			return nil, DecodeContainerError
+		}
+		pos += b.size
+		b.size -= hdrLen
+		boxes = append(boxes, b)
+	}
+	return boxes, nil
+}
+
+func readVarint(b []byte) (uint64, []byte, error) {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, DecodeIndexError
+		}
+		c := b[0]
+		b = b[1:]
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+	return 0, nil, DecodeIndexError
+}
+
+func ParseFrameIndex(b []byte) (*FrameIndex, error) {
+	n, b, err := readVarint(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, DecodeIndexError
+	}
+	idx := new(FrameIndex)
+	idx.TPSNumerator = binary.BigEndian.Uint32(b)
+	idx.TPSDenominator = binary.BigEndian.Uint32(b[4:])
+	b = b[8:]
+	if idx.TPSNumerator == 0 || n > uint64(len(b)) {
+		return nil, DecodeIndexError
+	}
+	var off, ticks, frame uint64
+	for i := uint64(0); i < n; i++ {
+		var v [3]uint64
+		for j := range v {
+			v[j], b, err = readVarint(b)
+			if err != nil {
+				return nil, err
+			}
+		}
+		off += v[0]
+		ticks += v[1]
+		frame += v[2]
+		idx.Entries = append(idx.Entries, FrameIndexEntry{
+			Offset: int64(off),
+			Time:   time.Duration(ticks) * time.Second * time.Duration(idx.TPSDenominator) / time.Duration(idx.TPSNumerator),
+			Frame:  int(frame),
+		})
+	}
+	return idx, nil
+}
+
+func readContainer(r io.ReaderAt, size int64) ([]segment, *FrameIndex, error) {
+	var sig [12]byte
+	if _, err := r.ReadAt(sig[:], 0); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if string(sig[:2]) == jxlHeader {
+		return []segment{{size: size}}, nil, nil
+	}
+	if string(sig[:]) != containerHeader {
+		return nil, nil, DecodeContainerError
+	}
+	boxes, err := readBoxes(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	var segs []segment
+	var idx *FrameIndex
+	pos := int64(0)
+	for _, b := range boxes {
+		switch b.typ {
+		case "jxlc":
+			segs = append(segs, segment{pos: pos, off: b.off, size: b.size})
+			pos += b.size
+		case "jxlp":
+			if b.size < 4 {
+				return nil, nil, DecodeContainerError
+			}
+			segs = append(segs, segment{pos: pos, off: b.off + 4, size: b.size - 4})
+			pos += b.size - 4
+		case "jxli":
+			buf := make([]byte, b.size)
+			if _, err := r.ReadAt(buf, b.off); err != nil {
+				return nil, nil, err
+			}
+			idx, err = ParseFrameIndex(buf)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return segs, idx, nil
+}
+
+func ReadFrameIndex(r io.ReaderAt, size int64) (*FrameIndex, error) {
+	_, idx, err := readContainer(r, size)
+	return idx, err
+}
+
+type codestreamReader struct {
+	r    io.ReaderAt
+	segs []segment
+	size int64
+	pos  int64
+}
+
+func (c *codestreamReader) Read(b []byte) (int, error) {
+	if c.pos >= c.size {
+		return 0, io.EOF
+	}
+	for _, s := range c.segs {
+		if c.pos >= s.pos+s.size {
+			continue
+		}
+		rel := c.pos - s.pos
+		if int64(len(b)) > s.size-rel {
+			b = b[:s.size-rel]
+		}
+		n, err := c.r.ReadAt(b, s.off+rel)
+		c.pos += int64(n)
+		if err == io.EOF && n == len(b) {
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (c *codestreamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	}
+	if offset < 0 {
+		return 0, DecodeSeekError
+	}
+	c.pos = offset
+	return offset, nil
+}
+
+// splice returns a codestream made of the image headers followed by the
+// frames starting at the given keyframe offset.
+func (c *codestreamReader) splice(header, keyframe int64) *codestreamReader {
+	out := &codestreamReader{r: c.r}
+	for _, s := range c.segs {
+		if s.pos < header {
+			if s.pos+s.size > header {
+				s.size = header - s.pos
+			}
+			out.segs = append(out.segs, segment{pos: out.size, off: s.off, size: s.size})
+			out.size += s.size
+		}
+	}
+	for _, s := range c.segs {
+		if s.pos+s.size <= keyframe {
+			continue
+		}
+		if s.pos < keyframe {
+			s.off += keyframe - s.pos
+			s.size -= keyframe - s.pos
+		}
+		out.segs = append(out.segs, segment{pos: out.size, off: s.off, size: s.size})
+		out.size += s.size
+	}
+	return out
+}
+
+// NewJxlDecoderAtFrame returns a decoder whose next Read returns frame n.
+// If the file has a frame index, decoding starts at the closest keyframe
+// before n instead of at the beginning of the codestream.
+func NewJxlDecoderAtFrame(r io.ReaderAt, size int64, n int, opts *DecoderOptions) (*JxlDecoder, error) {
+	segs, idx, err := readContainer(r, size)
+	if err != nil {
+		return nil, err
+	}
+	cs := &codestreamReader{r: r, segs: segs}
+	for _, s := range segs {
+		cs.size += s.size
+	}
+	var key FrameIndexEntry
+	if idx != nil && len(idx.Entries) != 0 && idx.Entries[0].Frame == 0 {
+		for _, e := range idx.Entries {
+			if e.Frame > n {
+				break
+			}
+			key = e
+		}
+	}
+	var in io.Reader = cs
+	if key.Frame != 0 {
+		in = cs.splice(idx.Entries[0].Offset, key.Offset)
+	}
+	d, err := NewDecoder(in, opts)
+	if err != nil {
+		return nil, err
+	}
+	if key.Frame != 0 {
+		d.firstFrame, d.frame = key.Frame, key.Frame
+		d.firstTime = key.Time
+	}
+	err = d.SeekFrame(n)
+	if err != nil {
+		d.Destroy()
+		return nil, err
+	}
+	return d, nil
+}
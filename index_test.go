@@ -0,0 +1,92 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func encodeIndexedVideo(t *testing.T, frames int) []byte {
+	f, err := os.Open(EncodeSingleImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	i, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i2 := i.(*image.RGBA)
+	buf := new(bytes.Buffer)
+	e := jxl.NewJxlEncoderWithOptions(buf, &jxl.EncoderOptions{FrameIndexInterval: 2})
+	defer e.Destroy()
+	e.SetInfo(i.Bounds().Dx(), i.Bounds().Dy(), color.RGBAModel, 10)
+	for n := 0; n < frames; n++ {
+		pix := make([]byte, len(i2.Pix))
+		copy(pix, i2.Pix)
+		for j := 0; j < len(pix); j += 4 {
+			pix[j] = byte(n * 40)
+		}
+		if n == frames-1 {
+			e.NextIsLast()
+		}
+		err = e.Write(pix)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestFrameIndex(t *testing.T) {
+	b := encodeIndexedVideo(t, 5)
+	idx, err := jxl.ReadFrameIndex(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx == nil {
+		t.Fatal("expected frame index box")
+	}
+	want := []int{0, 2, 4}
+	if len(idx.Entries) != len(want) {
+		t.Fatal("expected", len(want), "entries, got", len(idx.Entries))
+	}
+	for i, e := range idx.Entries {
+		if e.Frame != want[i] {
+			t.Error("expected keyframe", want[i], "got", e.Frame)
+		}
+	}
+}
+
+func TestDecoderAtFrame(t *testing.T) {
+	b := encodeIndexedVideo(t, 5)
+	d := jxl.NewJxlDecoder(bytes.NewReader(b))
+	defer d.Destroy()
+	var frames [][]byte
+	n, err := d.Read()
+	for n != nil {
+		frames = append(frames, n)
+		n, err = d.Read()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{3, 4, 1} {
+		d2, err := jxl.NewJxlDecoderAtFrame(bytes.NewReader(b), int64(len(b)), i, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := d2.Read()
+		d2.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(n, frames[i]) {
+			t.Error("frame mismatch at", i)
+		}
+	}
+}
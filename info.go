@@ -0,0 +1,89 @@
+package gojxl
+
+import "unsafe"
+
+// #include <jxl/decode.h>
+// #include <jxl/codestream_header.h>
+import "C"
+
+type ExtraChannelType int
+
+const (
+	ChannelAlpha ExtraChannelType = iota
+	ChannelDepth
+	ChannelSpotColor
+	ChannelSelectionMask
+	ChannelBlack
+	ChannelCFA
+	ChannelThermal
+	ChannelUnknown  ExtraChannelType = 15
+	ChannelOptional ExtraChannelType = 16
+)
+
+var extraChannelNames = map[ExtraChannelType]string{
+	ChannelAlpha:         "alpha",
+	ChannelDepth:         "depth",
+	ChannelSpotColor:     "spot_color",
+	ChannelSelectionMask: "selection_mask",
+	ChannelBlack:         "black",
+	ChannelCFA:           "cfa",
+	ChannelThermal:       "thermal",
+	ChannelUnknown:       "unknown",
+	ChannelOptional:      "optional",
+}
+
+func (t ExtraChannelType) String() string {
+	if name, ok := extraChannelNames[t]; ok {
+		return name
+	}
+	return "reserved"
+}
+
+func (t ExtraChannelType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type ExtraChannel struct {
+	Type         ExtraChannelType `json:"type"`
+	Name         string           `json:"name,omitempty"`
+	BitDepth     int              `json:"bits_per_sample"`
+	ExponentBits int              `json:"exponent_bits_per_sample"`
+	// DimShift is log2 of how much smaller the channel is than the image.
+	DimShift     int        `json:"dim_shift"`
+	AlphaPremult bool       `json:"alpha_premultiplied"`
+	SpotColor    [4]float32 `json:"spot_color"`
+	CFAChannel   int        `json:"cfa_channel"`
+}
+
+// extraChannels reads the extra channel table, which does not change once
+// the basic info is known.
+func (d *JxlDecoder) extraChannels(info *C.JxlBasicInfo) []ExtraChannel {
+	if d.extra != nil || info.num_extra_channels == 0 {
+		return d.extra
+	}
+	extra := make([]ExtraChannel, info.num_extra_channels)
+	for i := range extra {
+		var ec C.JxlExtraChannelInfo
+		if C.JxlDecoderGetExtraChannelInfo(d.decoder, C.size_t(i), &ec) != C.JXL_DEC_SUCCESS {
+			return nil
+		}
+		extra[i] = ExtraChannel{
+			Type:         ExtraChannelType(ec._type),
+			BitDepth:     int(ec.bits_per_sample),
+			ExponentBits: int(ec.exponent_bits_per_sample),
+			DimShift:     int(ec.dim_shift),
+			AlphaPremult: ec.alpha_premultiplied != 0,
+			CFAChannel:   int(ec.cfa_channel),
+		}
+		for c := range extra[i].SpotColor {
+			extra[i].SpotColor[c] = float32(ec.spot_color[c])
+		}
+		if ec.name_length != 0 {
+			name := make([]byte, ec.name_length+1)
+			C.JxlDecoderGetExtraChannelName(d.decoder, C.size_t(i), (*C.char)(unsafe.Pointer(&name[0])), C.size_t(len(name)))
+			extra[i].Name = string(name[:ec.name_length])
+		}
+	}
+	d.extra = extra
+	return extra
+}
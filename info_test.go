@@ -0,0 +1,115 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"os"
+	"strings"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestInfoExtraChannels(t *testing.T) {
+	src := loadEncodeInput(t)
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, src, &jxl.EncoderOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jxl.NewDecoder(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.UsesOriginalProfile {
+		t.Error("expected a lossless image to use its original profile")
+	}
+	if info.IntrinsicW != info.W || info.IntrinsicH != info.H {
+		t.Error("intrinsic size does not match", info.IntrinsicW, info.IntrinsicH)
+	}
+	if len(info.ExtraChannels) != 1 || info.ExtraChannels[0].Type != jxl.ChannelAlpha || info.ExtraChannels[0].BitDepth != 8 {
+		t.Fatalf("expected one 8-bit alpha channel, got %+v", info.ExtraChannels)
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"xsize":`, `"uses_original_profile":true`, `"extra_channels":[{"type":"alpha"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %s in %s", want, b)
+		}
+	}
+}
+
+func TestInfoAlphaPremultJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := jxl.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jxl.NewDecoder(buf, &jxl.DecoderOptions{Alpha: jxl.AlphaPremultiplied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.AlphaPremult || info.FileAlphaPremult {
+		t.Errorf("expected premultiplied output of a straight alpha image, got %+v", info)
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"alpha_premultiplied":false`) {
+		t.Error("expected the image's own alpha_premultiplied in", string(b))
+	}
+}
+
+func TestInfoCMYKChannel(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, image.NewCMYK(image.Rect(0, 0, 8, 8)), &jxl.EncoderOptions{Lossless: true, ICCProfile: cmykProfile()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := jxl.NewDecoder(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.ExtraChannels) != 1 || info.ExtraChannels[0].Type != jxl.ChannelBlack {
+		t.Errorf("expected a black channel, got %+v", info.ExtraChannels)
+	}
+}
+
+func TestInfoAnimation(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := jxl.NewDecoder(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Animated || info.TPSNumerator == 0 || info.TPSDenominator == 0 {
+		t.Errorf("expected animation timing, got %+v", info)
+	}
+}
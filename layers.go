@@ -0,0 +1,332 @@
+package gojxl
+
+import (
+	"time"
+	"unsafe"
+)
+
+// #include <jxl/decode.h>
+// #include <jxl/codestream_header.h>
+// #include <stdint.h>
+import "C"
+
+type BlendMode int
+
+const (
+	BlendReplace BlendMode = iota
+	BlendAdd
+	BlendBlend
+	BlendMulAdd
+	BlendMul
+)
+
+type BlendInfo struct {
+	Mode   BlendMode
+	Source int
+	Alpha  int
+	Clamp  bool
+}
+
+type LayerInfo struct {
+	HaveCrop        bool
+	CropX0, CropY0  int
+	W, H            int
+	Blend           BlendInfo
+	SaveAsReference int
+}
+
+type Layer struct {
+	LayerInfo
+	// AlphaBlend is how the alpha channel itself is blended, which libjxl
+	// keeps apart from Blend. It is only set for images with alpha.
+	AlphaBlend BlendInfo
+	Name       string
+	Duration   time.Duration
+	Last       bool
+	Pix        []byte
+	// Stride is the distance in bytes between rows of Pix. Zero means the
+	// rows are packed.
+	Stride int
+}
+
+func (d *JxlDecoder) loadFrameHeader() {
+	C.JxlDecoderGetFrameHeader(d.decoder, &d.header)
+	d.frameName = ""
+	if d.header.name_length == 0 {
+		return
+	}
+	name := make([]byte, d.header.name_length+1)
+	C.JxlDecoderGetFrameName(d.decoder, (*C.char)(unsafe.Pointer(&name[0])), C.size_t(len(name)))
+	d.frameName = string(name[:d.header.name_length])
+}
+
+func newLayer(header C.JxlFrameHeader, name string, durFrac time.Duration) *Layer {
+	l := new(Layer)
+	li := header.layer_info
+	l.HaveCrop = li.have_crop != 0
+	l.CropX0, l.CropY0 = int(li.crop_x0), int(li.crop_y0)
+	l.W, l.H = int(li.xsize), int(li.ysize)
+	l.Blend = newBlendInfo(&li.blend_info)
+	l.SaveAsReference = int(li.save_as_reference)
+	l.Name = name
+	l.Duration = time.Duration(header.duration) * durFrac
+	l.Last = header.is_last != 0
+	return l
+}
+
+func newBlendInfo(bi *C.JxlBlendInfo) BlendInfo {
+	return BlendInfo{
+		Mode:   BlendMode(bi.blendmode),
+		Source: int(bi.source),
+		Alpha:  int(bi.alpha),
+		Clamp:  bi.clamp != 0,
+	}
+}
+
+// alphaBlend returns the blend info of the current frame's alpha channel.
+func (d *JxlDecoder) alphaBlend() (BlendInfo, bool) {
+	for i, ec := range d.info.ExtraChannels {
+		if ec.Type != ChannelAlpha {
+			continue
+		}
+		var bi C.JxlBlendInfo
+		if C.JxlDecoderGetExtraChannelBlendInfo(d.decoder, C.size_t(i), &bi) != C.JXL_DEC_SUCCESS {
+			return BlendInfo{}, false
+		}
+		return newBlendInfo(&bi), true
+	}
+	return BlendInfo{}, false
+}
+
+func (d *JxlDecoder) ReadLayer() (*Layer, error) {
+	return d.readLayer(d.opts.Align, d.newFrame)
+}
+
+func (d *JxlDecoder) readLayer(align int, alloc func(n, min int) ([]byte, error)) (*Layer, error) {
+	if d.hitEnd {
+		return nil, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	if info.CMYK {
+		return nil, d.failed(DecodeFormatError)
+	}
+	fmt, sz := pixelFormat(info, align)
+	var layer *Layer
+	if d.inFrame {
+		layer = d.FrameHeader()
+	}
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch ev {
+		case EventSuccess:
+			return nil, nil
+		case EventFrame:
+			layer = d.FrameHeader()
+		case EventNeedImageOutBuffer:
+			if layer == nil {
+				// Without EventFrame there is no header to size the layer by.
+				return nil, DecodeEventsError
+			}
+			var size C.size_t
+			if C.JxlDecoderImageOutBufferSize(d.decoder, &fmt, &size) != C.JXL_DEC_SUCCESS {
+				return nil, d.failed(DecodeDataError)
+			}
+			layer.Pix, err = alloc(int(size), int(size))
+			if err != nil {
+				return nil, err
+			}
+			layer.Stride = rowStride(layer.W, sz, align)
+			if d.setOutBuffer(&fmt, layer.Pix) != C.JXL_DEC_SUCCESS {
+				return nil, d.failed(DecodeDataError)
+			}
+		case EventFullImage:
+			if d.mustPremultiply(info) {
+				premultiply(layer.Pix, layer.W, layer.H, layer.Stride, info.BitDepth == 16)
+			}
+			return layer, nil
+		}
+	}
+}
+
+// Compositor blends layers from ReadLayer the way libjxl coalesces them.
+// Only the alpha channel is blended along with the color; other extra
+// channels are not kept.
+type Compositor struct {
+	w, h     int
+	channels int
+	depth16  bool
+	alpha    bool
+	premult  bool
+	refs     [4][]float32
+}
+
+func NewCompositor(info JxlInfo) *Compositor {
+	c := new(Compositor)
+	c.w, c.h = info.W, info.H
+	c.channels = info.Channels
+	if c.channels != 1 {
+		c.channels++
+		c.alpha = true
+	}
+	c.depth16 = info.BitDepth == 16
+	c.premult = info.AlphaPremult
+	return c
+}
+
+func (c *Compositor) sample(buf []byte, i int) float32 {
+	if c.depth16 {
+		return float32(uint16(buf[2*i])<<8|uint16(buf[2*i+1])) / 0xffff
+	}
+	return float32(buf[i]) / 0xff
+}
+
+func clamp01(f float32) float32 {
+	if f < 0 {
+		return 0
+	} else if f > 1 {
+		return 1
+	}
+	return f
+}
+
+// blend composites one pixel. The color channels follow l.Blend and the
+// alpha channel follows l.AlphaBlend, as libjxl does.
+func (c *Compositor) blend(l *Layer, old, new []float32) {
+	nc := c.channels
+	if c.alpha {
+		nc--
+	}
+	var a, oldA float32 = 1, 1
+	if c.alpha {
+		a, oldA = new[nc], old[nc]
+	}
+	outA := a + oldA*(1-a)
+	switch l.Blend.Mode {
+	case BlendReplace:
+		copy(old[:nc], new)
+	case BlendAdd:
+		for i := 0; i < nc; i++ {
+			old[i] += new[i]
+		}
+	case BlendMul:
+		for i := 0; i < nc; i++ {
+			old[i] *= new[i]
+		}
+	case BlendMulAdd:
+		for i := 0; i < nc; i++ {
+			old[i] += a * new[i]
+		}
+	case BlendBlend:
+		for i := 0; i < nc; i++ {
+			if !c.alpha {
+				old[i] = new[i]
+			} else if c.premult {
+				old[i] = new[i] + old[i]*(1-a)
+			} else if outA > 0 {
+				old[i] = (new[i]*a + old[i]*oldA*(1-a)) / outA
+			} else {
+				old[i] = 0
+			}
+		}
+	}
+	if l.Blend.Clamp {
+		for i := 0; i < nc; i++ {
+			old[i] = clamp01(old[i])
+		}
+	}
+	if !c.alpha {
+		return
+	}
+	switch l.AlphaBlend.Mode {
+	case BlendReplace:
+		old[nc] = a
+	case BlendAdd:
+		old[nc] += a
+	case BlendMul:
+		old[nc] *= a
+	case BlendBlend:
+		old[nc] = outA
+	}
+	// BlendMulAdd keeps the old alpha.
+	if l.AlphaBlend.Clamp {
+		old[nc] = clamp01(old[nc])
+	}
+}
+
+// Add blends a layer onto its reference canvas. It returns the composited
+// frame if the layer is displayed, and nil if it only feeds later layers.
+func (c *Compositor) Add(l *Layer) []byte {
+	canvas := make([]float32, c.w*c.h*c.channels)
+	if ref := c.refs[l.Blend.Source]; ref != nil {
+		copy(canvas, ref)
+	}
+	x0, y0 := l.CropX0, l.CropY0
+	if !l.HaveCrop {
+		x0, y0 = 0, 0
+	}
+	px := make([]float32, c.channels)
+	stride := l.Stride
+	if stride == 0 {
+		stride = l.W * c.channels
+		if c.depth16 {
+			stride *= 2
+		}
+	}
+	for y := 0; y < l.H; y++ {
+		cy := y + y0
+		if cy < 0 || cy >= c.h {
+			continue
+		}
+		row := l.Pix[y*stride:]
+		for x := 0; x < l.W; x++ {
+			cx := x + x0
+			if cx < 0 || cx >= c.w {
+				continue
+			}
+			off := x * c.channels
+			for i := range px {
+				px[i] = c.sample(row, off+i)
+			}
+			dst := canvas[(cy*c.w+cx)*c.channels:][:c.channels]
+			c.blend(l, dst, px)
+		}
+	}
+	if !l.Last && (l.Duration == 0 || l.SaveAsReference != 0) {
+		c.refs[l.SaveAsReference] = canvas
+	}
+	if l.Duration == 0 && !l.Last {
+		return nil
+	}
+	bps := 1
+	if c.depth16 {
+		bps = 2
+	}
+	out := make([]byte, len(canvas)*bps)
+	for i, f := range canvas {
+		v := clamp01(f)
+		if c.depth16 {
+			s := uint16(v*0xffff + 0.5)
+			out[2*i], out[2*i+1] = byte(s>>8), byte(s)
+		} else {
+			out[i] = byte(v*0xff + 0.5)
+		}
+	}
+	return out
+}
+
+func Composite(info JxlInfo, layers []*Layer) []byte {
+	c := NewCompositor(info)
+	var out []byte
+	for _, l := range layers {
+		if b := c.Add(l); b != nil {
+			out = b
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package gojxl_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestReadLayer(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoderWithOptions(f, &jxl.DecoderOptions{Layers: true})
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := jxl.NewCompositor(info)
+	var last []byte
+	l, err := d.ReadLayer()
+	for l != nil {
+		if len(l.Pix) != l.W*l.H*4 {
+			t.Fatal("layer buffer size mismatch", len(l.Pix), l.W, l.H)
+		}
+		if b := c.Add(l); b != nil {
+			last = b
+		}
+		l, err = d.ReadLayer()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+	d2 := jxl.NewJxlDecoder(f)
+	defer d2.Destroy()
+	var want []byte
+	n, err := d2.Read()
+	for n != nil {
+		want = n
+		n, err = d2.Read()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != len(want) {
+		t.Fatal("composited size mismatch", len(last), len(want))
+	}
+	for i := range want {
+		diff := int(last[i]) - int(want[i])
+		if diff > 2 || diff < -2 {
+			t.Fatal("composited frame differs at", i, last[i], want[i])
+		}
+	}
+}
+
+func TestCompositeBlend(t *testing.T) {
+	info := jxl.JxlInfo{W: 2, H: 1, BitDepth: 8, Channels: 3, Alpha: 8}
+	base := &jxl.Layer{Pix: []byte{255, 0, 0, 255, 255, 0, 0, 255}}
+	base.W, base.H = 2, 1
+	top := &jxl.Layer{Pix: []byte{0, 0, 255, 255}, Last: true}
+	top.HaveCrop = true
+	top.CropX0 = 1
+	top.W, top.H = 1, 1
+	top.Blend.Mode = jxl.BlendBlend
+	top.AlphaBlend.Mode = jxl.BlendBlend
+	out := jxl.Composite(info, []*jxl.Layer{base, top})
+	want := []byte{255, 0, 0, 255, 0, 0, 255, 255}
+	if string(out) != string(want) {
+		t.Error("expected", want, "got", out)
+	}
+}
+
+func TestCompositeAlphaBlend(t *testing.T) {
+	info := jxl.JxlInfo{W: 1, H: 1, BitDepth: 8, Channels: 3, Alpha: 8}
+	tests := []struct {
+		name        string
+		mode, alpha jxl.BlendMode
+		base, top   []byte
+		want        []byte
+	}{
+		{"add", jxl.BlendAdd, jxl.BlendReplace, []byte{100, 0, 0, 255}, []byte{50, 0, 0, 0}, []byte{150, 0, 0, 0}},
+		{"muladd", jxl.BlendMulAdd, jxl.BlendMulAdd, []byte{100, 0, 0, 128}, []byte{100, 0, 0, 255}, []byte{200, 0, 0, 128}},
+		{"mul", jxl.BlendMul, jxl.BlendReplace, []byte{255, 0, 0, 255}, []byte{51, 0, 0, 128}, []byte{51, 0, 0, 128}},
+	}
+	for _, tt := range tests {
+		base := &jxl.Layer{Pix: tt.base}
+		base.W, base.H = 1, 1
+		top := &jxl.Layer{Pix: tt.top, Last: true}
+		top.W, top.H = 1, 1
+		top.Blend.Mode = tt.mode
+		top.AlphaBlend.Mode = tt.alpha
+		out := jxl.Composite(info, []*jxl.Layer{base, top})
+		if string(out) != string(tt.want) {
+			t.Error(tt.name, "expected", tt.want, "got", out)
+		}
+	}
+}
+
+func TestLayersNeedReadLayer(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Layers of an animation may be cropped, so they cannot be returned as
+	// whole canvases.
+	_, err = jxl.DecodeWithOptions(f, &jxl.DecoderOptions{Layers: true})
+	if !errors.Is(err, jxl.DecodeFormatError) {
+		t.Error("expected DecodeFormatError from DecodeWithOptions, got", err)
+	}
+	f.Seek(0, 0)
+	d := jxl.NewJxlDecoderWithOptions(f, &jxl.DecoderOptions{Layers: true})
+	defer d.Destroy()
+	info, err := d.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Read(); !errors.Is(err, jxl.DecodeFormatError) {
+		t.Error("expected DecodeFormatError from Read, got", err)
+	}
+	if _, err = d.ReadInto(make([]byte, info.W*info.H*4)); !errors.Is(err, jxl.DecodeFormatError) {
+		t.Error("expected DecodeFormatError from ReadInto, got", err)
+	}
+	l, err := d.ReadLayer()
+	if err != nil || l == nil {
+		t.Fatal("expected ReadLayer to still work, got", err)
+	}
+	if len(l.Pix) != l.W*l.H*4 {
+		t.Error("layer buffer size mismatch", len(l.Pix), l.W, l.H)
+	}
+}
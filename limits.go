@@ -0,0 +1,142 @@
+package gojxl
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <jxl/memory_manager.h>
+// typedef struct {
+//     JxlMemoryManager mm;
+//     size_t limit;
+//     size_t used;
+//     int exceeded;
+// } jxlBudget;
+// static void *jxlBudgetAlloc(void *opaque, size_t size) {
+//     jxlBudget *b = opaque;
+//     size_t total = size + 16;
+//     if (total < size || __atomic_add_fetch(&b->used, total, __ATOMIC_RELAXED) > b->limit) {
+//         if (total >= size) __atomic_sub_fetch(&b->used, total, __ATOMIC_RELAXED);
+//         __atomic_store_n(&b->exceeded, 1, __ATOMIC_RELAXED);
+//         return NULL;
+//     }
+//     size_t *p = malloc(total);
+//     if (p == NULL) {
+//         __atomic_sub_fetch(&b->used, total, __ATOMIC_RELAXED);
+//         return NULL;
+//     }
+//     p[0] = total;
+//     return (char *)p + 16;
+// }
+// static void jxlBudgetFree(void *opaque, void *address) {
+//     if (address == NULL) return;
+//     jxlBudget *b = opaque;
+//     size_t *p = (size_t *)((char *)address - 16);
+//     __atomic_sub_fetch(&b->used, p[0], __ATOMIC_RELAXED);
+//     free(p);
+// }
+// static jxlBudget *jxlBudgetNew(size_t limit) {
+//     jxlBudget *b = calloc(1, sizeof(jxlBudget));
+//     if (b == NULL) return NULL;
+//     b->mm.opaque = b;
+//     b->mm.alloc = jxlBudgetAlloc;
+//     b->mm.free = jxlBudgetFree;
+//     b->limit = limit;
+//     return b;
+// }
+// static int jxlBudgetExceeded(jxlBudget *b) {
+//     return __atomic_load_n(&b->exceeded, __ATOMIC_RELAXED);
+// }
+// static void jxlBudgetClear(jxlBudget *b) {
+//     __atomic_store_n(&b->exceeded, 0, __ATOMIC_RELAXED);
+// }
+import "C"
+
+type memBudget = C.jxlBudget
+
+// DecoderLimits bounds the resources a single decode may use. Zero fields
+// are unlimited.
+type DecoderLimits struct {
+	MaxWidth, MaxHeight int
+	MaxPixels           int64
+	MaxFrames           int
+	MaxAnimationPixels  int64
+	MaxInputBytes       int64
+	// MaxMemory bounds the bytes libjxl may allocate internally.
+	MaxMemory int64
+}
+
+type LimitError struct {
+	Limit      string
+	Value, Max int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == "memory" {
+		return fmt.Sprintf("jxl decode error: memory use exceeds limit %d", e.Max)
+	}
+	return fmt.Sprintf("jxl decode error: %s %d exceeds limit %d", e.Limit, e.Value, e.Max)
+}
+
+func checkLimit(name string, value, max int64) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: name, Value: value, Max: max}
+	}
+	return nil
+}
+
+func newBudget(limit int64) *memBudget {
+	return C.jxlBudgetNew(C.size_t(limit))
+}
+
+func (d *JxlDecoder) memoryManager() *C.JxlMemoryManager {
+	if d.budget == nil {
+		return nil
+	}
+	return &d.budget.mm
+}
+
+func (d *JxlDecoder) freeBudget() {
+	if d.budget != nil {
+		C.free(unsafe.Pointer(d.budget))
+		d.budget = nil
+	}
+}
+
+// clearBudget forgets a past failure once the decoder starts over. The bytes
+// in use are left alone, since they drop by themselves as libjxl frees its
+// old state, and zeroing them would make those frees underflow.
+func (d *JxlDecoder) clearBudget() {
+	if d.budget != nil {
+		C.jxlBudgetClear(d.budget)
+	}
+}
+
+func (d *JxlDecoder) memoryExceeded() bool {
+	return d.budget != nil && C.jxlBudgetExceeded(d.budget) != 0
+}
+
+func (d *JxlDecoder) checkInfo(info JxlInfo) error {
+	l := &d.opts.Limits
+	if err := checkLimit("width", int64(info.W), int64(l.MaxWidth)); err != nil {
+		return err
+	}
+	if err := checkLimit("height", int64(info.H), int64(l.MaxHeight)); err != nil {
+		return err
+	}
+	return checkLimit("pixels", int64(info.W)*int64(info.H), l.MaxPixels)
+}
+
+func (d *JxlDecoder) checkFrame() error {
+	l := &d.opts.Limits
+	if err := checkLimit("frames", int64(d.frame+1), int64(l.MaxFrames)); err != nil {
+		return err
+	}
+	w, h := int64(d.header.layer_info.xsize), int64(d.header.layer_info.ysize)
+	if err := checkLimit("pixels", w*h, l.MaxPixels); err != nil {
+		return err
+	}
+	d.pixels += w * h
+	return checkLimit("animation pixels", d.pixels, l.MaxAnimationPixels)
+}
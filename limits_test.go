@@ -0,0 +1,116 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func decodeLimited(t *testing.T, name string, limits jxl.DecoderLimits) error {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoderWithOptions(f, &jxl.DecoderOptions{Limits: limits})
+	defer d.Destroy()
+	n, err := d.Read()
+	for n != nil {
+		n, err = d.Read()
+	}
+	return err
+}
+
+func TestDecoderLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		limits jxl.DecoderLimits
+	}{
+		{"width", DecodeSingleImgName, jxl.DecoderLimits{MaxWidth: 16}},
+		{"height", DecodeSingleImgName, jxl.DecoderLimits{MaxHeight: 16}},
+		{"pixels", DecodeSingleImgName, jxl.DecoderLimits{MaxPixels: 256}},
+		{"frames", DecodeVideoName, jxl.DecoderLimits{MaxFrames: 2}},
+		{"input bytes", DecodeVideoName, jxl.DecoderLimits{MaxInputBytes: 100000}},
+		{"memory", DecodeSingleImgName, jxl.DecoderLimits{MaxMemory: 1 << 16}},
+	}
+	for _, tt := range tests {
+		err := decodeLimited(t, tt.file, tt.limits)
+		var lerr *jxl.LimitError
+		if !errors.As(err, &lerr) {
+			t.Error(tt.name, "expected LimitError, got", err)
+		} else if lerr.Limit != tt.name {
+			t.Error("expected", tt.name, "limit, got", lerr.Limit)
+		}
+	}
+}
+
+func TestDecoderLimitsPass(t *testing.T) {
+	err := decodeLimited(t, DecodeVideoName, jxl.DecoderLimits{
+		MaxWidth:      1 << 14,
+		MaxHeight:     1 << 14,
+		MaxPixels:     1 << 28,
+		MaxFrames:     1 << 10,
+		MaxInputBytes: 1 << 30,
+		MaxMemory:     1 << 30,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// failReaderAt fails the test if it is ever read.
+type failReaderAt struct{ t *testing.T }
+
+func (f failReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	f.t.Error("read input that is over the limit")
+	return 0, io.EOF
+}
+
+func TestReaderAtLimit(t *testing.T) {
+	_, err := jxl.NewJxlDecoderFromReaderAt(failReaderAt{t}, 1<<40, &jxl.DecoderOptions{
+		Limits: jxl.DecoderLimits{MaxInputBytes: 1 << 20},
+	})
+	var lerr *jxl.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != "input bytes" {
+		t.Error("expected input bytes LimitError, got", err)
+	}
+}
+
+func TestMemoryLimitReset(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoderWithOptions(f, &jxl.DecoderOptions{
+		Threads: jxl.ThreadsSingle,
+		Limits:  jxl.DecoderLimits{MaxMemory: 2 << 20},
+	})
+	defer d.Destroy()
+	_, err = d.Read()
+	var lerr *jxl.LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != "memory" {
+		t.Fatal("expected memory LimitError, got", err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Reset(buf)
+	n, err := d.Read()
+	if err != nil || n == nil {
+		t.Error("expected a small image to decode after Reset, got", err)
+	}
+	d.Reset(bytes.NewReader([]byte("not a jxl file")))
+	_, err = d.Read()
+	if errors.As(err, &lerr) {
+		t.Error("expected a header error, not", err)
+	}
+}
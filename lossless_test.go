@@ -0,0 +1,104 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// pattern16 fills every 16-bit sample with a value whose high and low bytes
+// differ, so that swapped bytes cannot go unnoticed.
+func pattern16(x, y, c int) uint16 {
+	return uint16(x*977+y*131+c*4099) ^ 0x5a3c
+}
+
+func roundTrip(t *testing.T, img image.Image, opts *jxl.EncoderOptions) image.Image {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	err := jxl.EncodeWithOptions(buf, img, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestLossless16(t *testing.T) {
+	r := image.Rect(0, 0, 37, 23)
+	gray := image.NewGray16(r)
+	nrgba := image.NewNRGBA64(r)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			gray.SetGray16(x, y, color.Gray16{pattern16(x, y, 0)})
+			nrgba.SetNRGBA64(x, y, color.NRGBA64{pattern16(x, y, 0), pattern16(x, y, 1), pattern16(x, y, 2), pattern16(x, y, 3)})
+		}
+	}
+	opts := &jxl.EncoderOptions{Lossless: true}
+	if out, ok := roundTrip(t, gray, opts).(*image.Gray16); !ok || !bytes.Equal(out.Pix, gray.Pix) {
+		t.Error("Gray16 did not round-trip exactly")
+	}
+	if out, ok := roundTrip(t, nrgba, opts).(*image.NRGBA64); !ok || !bytes.Equal(out.Pix, nrgba.Pix) {
+		t.Error("NRGBA64 did not round-trip exactly")
+	}
+}
+
+func TestLosslessSubImage(t *testing.T) {
+	src := image.NewGray16(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			src.SetGray16(x, y, color.Gray16{pattern16(x, y, 0)})
+		}
+	}
+	sub := src.SubImage(image.Rect(5, 7, 29, 31)).(*image.Gray16)
+	out, ok := roundTrip(t, sub, &jxl.EncoderOptions{Lossless: true}).(*image.Gray16)
+	if !ok {
+		t.Fatal("expected *image.Gray16")
+	}
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 24; x++ {
+			if out.Gray16At(x, y) != sub.Gray16At(x+5, y+7) {
+				t.Fatalf("pixel %d,%d differs", x, y)
+			}
+		}
+	}
+}
+
+func TestWriteByteOrder(t *testing.T) {
+	const w, h = 16, 8
+	want := image.NewGray16(image.Rect(0, 0, w, h))
+	raw := make([]byte, 2*w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := pattern16(x, y, 0)
+			want.SetGray16(x, y, color.Gray16{v})
+			binary.LittleEndian.PutUint16(raw[2*(y*w+x):], v)
+		}
+	}
+	buf := new(bytes.Buffer)
+	e, err := jxl.NewEncoder(buf, &jxl.EncoderOptions{ByteOrder: binary.LittleEndian, Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy()
+	if !e.SetInfo(w, h, color.Gray16Model, 0) {
+		t.Fatal(e.Err())
+	}
+	err = e.Write(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := out.(*image.Gray16); !ok || !bytes.Equal(g.Pix, want.Pix) {
+		t.Error("little-endian input did not round-trip")
+	}
+}
@@ -0,0 +1,150 @@
+package gojxl
+
+import (
+	"image"
+	"image/color"
+)
+
+// rgbModel and rgb48Model describe packed buffers of opaque RGB pixels, for
+// which the standard library has no model of its own.
+var rgbModel = color.ModelFunc(func(c color.Color) color.Color {
+	return color.RGBAModel.Convert(c)
+})
+
+var rgb48Model = color.ModelFunc(func(c color.Color) color.Color {
+	return color.RGBA64Model.Convert(c)
+})
+
+// packImage lays out the pixels of img the way SetInfo expects for the
+// returned model, starting at img.Bounds().Min. Rows are stride bytes apart,
+// or packed if stride is zero. CMYK is only kept if cmyk is set, as it needs
+// a profile; otherwise it is converted to RGB.
+func packImage(img image.Image, cmyk bool) ([]byte, color.Model, int) {
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	switch i := img.(type) {
+	case *image.Gray:
+		buf, stride := packRows(i.Pix, i.Stride, w, h)
+		return buf, color.GrayModel, stride
+	case *image.Gray16:
+		buf, stride := packRows(i.Pix, i.Stride, 2*w, h)
+		return buf, color.Gray16Model, stride
+	case *image.RGBA:
+		buf, stride := packRows(i.Pix, i.Stride, 4*w, h)
+		return buf, color.RGBAModel, stride
+	case *image.RGBA64:
+		buf, stride := packRows(i.Pix, i.Stride, 8*w, h)
+		return buf, color.RGBA64Model, stride
+	case *image.NRGBA:
+		buf, stride := packRows(i.Pix, i.Stride, 4*w, h)
+		return buf, color.NRGBAModel, stride
+	case *image.NRGBA64:
+		buf, stride := packRows(i.Pix, i.Stride, 8*w, h)
+		return buf, color.NRGBA64Model, stride
+	case *image.YCbCr:
+		buf := make([]byte, 0, 3*w*h)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				yi, ci := i.YOffset(x, y), i.COffset(x, y)
+				r, g, b := color.YCbCrToRGB(i.Y[yi], i.Cb[ci], i.Cr[ci])
+				buf = append(buf, r, g, b)
+			}
+		}
+		return buf, rgbModel, 0
+	case *image.NYCbCrA:
+		buf := make([]byte, 0, 4*w*h)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				yi, ci := i.YOffset(x, y), i.COffset(x, y)
+				r, g, b := color.YCbCrToRGB(i.Y[yi], i.Cb[ci], i.Cr[ci])
+				buf = append(buf, r, g, b, i.A[i.AOffset(x, y)])
+			}
+		}
+		return buf, color.NRGBAModel, 0
+	case *image.CMYK:
+		if cmyk {
+			buf, stride := packRows(i.Pix, i.Stride, 4*w, h)
+			return buf, color.CMYKModel, stride
+		}
+	case *image.Paletted:
+		buf, model := packPaletted(i)
+		return buf, model, 0
+	}
+	buf, model := packGeneric(img)
+	return buf, model, 0
+}
+
+// packRows passes padded rows through as they are, unless pix ends right
+// after the last row, as in a sub-image, which libjxl would reject as short.
+func packRows(pix []byte, stride, row, h int) ([]byte, int) {
+	if stride == row {
+		return pix[:row*h], 0
+	}
+	if len(pix) >= stride*h {
+		return pix[:stride*h], stride
+	}
+	buf := make([]byte, row*h)
+	for y := 0; y < h; y++ {
+		copy(buf[y*row:(y+1)*row], pix[y*stride:])
+	}
+	return buf, 0
+}
+
+func packPaletted(img *image.Paletted) ([]byte, color.Model) {
+	opaque := true
+	pal := make([]color.NRGBA, len(img.Palette))
+	for n, c := range img.Palette {
+		pal[n] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		opaque = opaque && pal[n].A == 0xff
+	}
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	size := 4
+	if opaque {
+		size = 3
+	}
+	buf := make([]byte, 0, size*w*h)
+	for y := 0; y < h; y++ {
+		for _, n := range img.Pix[y*img.Stride : y*img.Stride+w] {
+			var c color.NRGBA
+			if int(n) < len(pal) {
+				c = pal[n]
+			}
+			buf = append(buf, c.R, c.G, c.B)
+			if !opaque {
+				buf = append(buf, c.A)
+			}
+		}
+	}
+	if opaque {
+		return buf, rgbModel
+	}
+	return buf, color.NRGBAModel
+}
+
+// packGeneric converts any other image through color.NRGBA64, which keeps
+// the full 16 bits that image.Image exposes.
+func packGeneric(img image.Image) ([]byte, color.Model) {
+	rect := img.Bounds()
+	w, h := rect.Dx(), rect.Dy()
+	o, ok := img.(interface{ Opaque() bool })
+	opaque := ok && o.Opaque()
+	size := 8
+	if opaque {
+		size = 6
+	}
+	buf := make([]byte, 0, size*w*h)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			buf = append(buf, byte(c.R>>8), byte(c.R), byte(c.G>>8), byte(c.G), byte(c.B>>8), byte(c.B))
+			if !opaque {
+				buf = append(buf, byte(c.A>>8), byte(c.A))
+			}
+		}
+	}
+	if opaque {
+		return buf, rgb48Model
+	}
+	return buf, color.NRGBA64Model
+}
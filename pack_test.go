@@ -0,0 +1,115 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/jpeg"
+	"math/bits"
+	"os"
+	"testing"
+
+	"github.com/devedge/imagehash"
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func loadEncodeInput(t *testing.T) *image.RGBA {
+	f, err := os.Open(EncodeSingleImageName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	i, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i.(*image.RGBA)
+}
+
+func dhash(img image.Image) uint64 {
+	h, _ := imagehash.DhashHorizontal(img, 8)
+	return binary.BigEndian.Uint64(h)
+}
+
+// checkEncoded encodes img, decodes the result and compares the two by hash.
+func checkEncoded(t *testing.T, img image.Image) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	err := jxl.Encode(buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds().Size() != img.Bounds().Size() {
+		t.Fatal("size does not match", img.Bounds().Size(), out.Bounds().Size())
+	}
+	if d := bits.OnesCount64(dhash(img) ^ dhash(out)); d > 2 {
+		t.Errorf("hash differs in %d bits", d)
+	}
+}
+
+func TestEncodeSubImage(t *testing.T) {
+	i := loadEncodeInput(t)
+	r := i.Bounds()
+	checkEncoded(t, i.SubImage(image.Rect(r.Dx()/4, r.Dy()/4, r.Dx()*3/4, r.Dy()*3/4)))
+}
+
+func TestEncodeYCbCr(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, loadEncodeInput(t), &jpeg.Options{Quality: 95})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := jpeg.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.(*image.YCbCr); !ok {
+		t.Fatalf("expected *image.YCbCr, got %T", i)
+	}
+	checkEncoded(t, i)
+}
+
+func TestEncodePaletted(t *testing.T) {
+	src := loadEncodeInput(t)
+	i := image.NewPaletted(src.Bounds(), palette.Plan9)
+	draw.Draw(i, i.Rect, src, src.Rect.Min, draw.Src)
+	checkEncoded(t, i)
+}
+
+func TestEncodeCMYK(t *testing.T) {
+	src := loadEncodeInput(t)
+	i := image.NewCMYK(src.Bounds())
+	draw.Draw(i, i.Rect, src, src.Rect.Min, draw.Src)
+	checkEncoded(t, i)
+}
+
+func TestEncodeGeneric(t *testing.T) {
+	src := loadEncodeInput(t)
+	checkEncoded(t, struct{ image.Image }{src})
+	a := image.NewAlpha16(src.Bounds())
+	draw.Draw(a, a.Rect, src, src.Rect.Min, draw.Src)
+	for _, i := range []image.Image{struct{ image.Image }{src}, a} {
+		buf := new(bytes.Buffer)
+		err := jxl.Encode(buf, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jxl.DecodeConfig(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != src.Rect.Dx() || cfg.Height != src.Rect.Dy() {
+			t.Error("size does not match", src.Rect, cfg.Width, cfg.Height)
+		}
+		if cfg.ColorModel != color.NRGBA64Model {
+			t.Error("expected 16-bit output, got", cfg.ColorModel)
+		}
+	}
+}
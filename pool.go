@@ -0,0 +1,130 @@
+package gojxl
+
+import (
+	"image"
+	"sync"
+)
+
+// framePoolSize is how many buffers a FramePool holds on to.
+const framePoolSize = 8
+
+// FramePool recycles frame buffers between decodes. Buffers that are too
+// small for the frame being decoded are dropped. Unlike a sync.Pool, it
+// keeps up to a few buffers alive until they are reused, and Get and Put
+// do not allocate.
+type FramePool struct {
+	mu   sync.Mutex
+	free [][]byte
+}
+
+func NewFramePool() *FramePool {
+	return &FramePool{free: make([][]byte, 0, framePoolSize)}
+}
+
+func (p *FramePool) Get(n int) []byte {
+	p.mu.Lock()
+	var b []byte
+	if len(p.free) != 0 {
+		b = p.free[len(p.free)-1]
+		p.free[len(p.free)-1] = nil
+		p.free = p.free[:len(p.free)-1]
+	}
+	p.mu.Unlock()
+	if cap(b) >= n {
+		return b[:n]
+	}
+	return make([]byte, n)
+}
+
+// Put hands b back to the pool. b must not be used afterwards.
+func (p *FramePool) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	p.mu.Lock()
+	if len(p.free) < framePoolSize {
+		p.free = append(p.free, b)
+	}
+	p.mu.Unlock()
+}
+
+// PutImage hands back the pixels of an image returned by the Decode helpers.
+func (p *FramePool) PutImage(img image.Image) {
+	if pix, _, ok := imagePix(img); ok {
+		p.Put(pix)
+	}
+}
+
+func imagePix(img image.Image) ([]byte, int, bool) {
+	switch i := img.(type) {
+	case *image.Gray:
+		return i.Pix, i.Stride, true
+	case *image.Gray16:
+		return i.Pix, i.Stride, true
+	case *image.NRGBA:
+		return i.Pix, i.Stride, true
+	case *image.NRGBA64:
+		return i.Pix, i.Stride, true
+	case *image.RGBA:
+		return i.Pix, i.Stride, true
+	case *image.RGBA64:
+		return i.Pix, i.Stride, true
+	case *image.CMYK:
+		return i.Pix, i.Stride, true
+	}
+	return nil, 0, false
+}
+
+// ReadInto is Read, but decodes into dst, which must be large enough to
+// hold the frame. It returns the part of dst that was written.
+func (d *JxlDecoder) ReadInto(dst []byte) ([]byte, error) {
+	return d.readInto(dst, d.opts.Align)
+}
+
+// ReadIntoStride is ReadInto for a buffer whose rows are stride bytes apart.
+func (d *JxlDecoder) ReadIntoStride(dst []byte, stride int) ([]byte, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	_, sz := pixelFormat(info, 0)
+	if stride < sz*info.W {
+		return nil, DecodeBufferError
+	}
+	return d.readInto(dst, stride)
+}
+
+func (d *JxlDecoder) readInto(dst []byte, align int) ([]byte, error) {
+	return d.read(align, func(n, min int) ([]byte, error) {
+		if len(dst) < min {
+			return nil, DecodeBufferError
+		}
+		if len(dst) < n {
+			return dst, nil
+		}
+		return dst[:n], nil
+	})
+}
+
+// ReadImage decodes the next frame into img, which must have the color model
+// DecodeConfig reports and the image's size. Like Read, it returns img, or
+// nil once there are no more frames.
+func (d *JxlDecoder) ReadImage(img image.Image) (image.Image, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	pix, stride, ok := imagePix(img)
+	if !ok || img.ColorModel() != colorModel(info) {
+		return nil, DecodeBufferError
+	}
+	rect := img.Bounds()
+	if rect.Dx() != info.W || rect.Dy() != info.H {
+		return nil, DecodeBufferError
+	}
+	buf, err := d.ReadIntoStride(pix, stride)
+	if buf == nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,181 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// newImageLike returns an empty image of the same type as img covering r.
+func newImageLike(img image.Image, r image.Rectangle) image.Image {
+	switch img.(type) {
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	case *image.RGBA:
+		return image.NewRGBA(r)
+	case *image.RGBA64:
+		return image.NewRGBA64(r)
+	case *image.NRGBA:
+		return image.NewNRGBA(r)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r)
+	}
+	return nil
+}
+
+func TestReadInto(t *testing.T) {
+	frames := readVideoFrames(t)
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	dst := make([]byte, len(frames[0])+16)
+	_, err = d.ReadInto(dst[:len(frames[0])-1])
+	if err != jxl.DecodeBufferError {
+		t.Fatal("expected DecodeBufferError, got", err)
+	}
+	for i, want := range frames {
+		got, err := d.ReadInto(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if &got[0] != &dst[0] || !bytes.Equal(got, want) {
+			t.Fatalf("frame %d was not decoded into dst", i)
+		}
+	}
+	got, err := d.ReadInto(dst)
+	if got != nil || err != nil {
+		t.Error("expected end of stream, got", err)
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := jxl.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, io.SeekStart)
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	_, err = d.ReadImage(image.NewGray(image.Rect(0, 0, 1, 1)))
+	if err != jxl.DecodeBufferError {
+		t.Fatal("expected DecodeBufferError, got", err)
+	}
+	got := newImageLike(want, want.Bounds())
+	out, err := d.ReadImage(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != got {
+		t.Error("expected ReadImage to return its argument")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("decoded image differs from Decode")
+	}
+	out, err = d.ReadImage(got)
+	if out != nil || err != nil {
+		t.Error("expected end of stream, got", err)
+	}
+}
+
+func TestFramePool(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := jxl.NewFramePool()
+	opts := &jxl.DecoderOptions{Pool: pool}
+	first, err := jxl.DecodeWithOptions(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(nil), pix(first)...)
+	pool.PutImage(first)
+	for i := 0; i < 3; i++ {
+		img, err := jxl.DecodeWithOptions(bytes.NewReader(data), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pix(img), want) {
+			t.Fatal("pooled decode differs")
+		}
+		pool.PutImage(img)
+	}
+	if b := pool.Get(4); len(b) != 4 {
+		t.Error("expected a 4 byte buffer, got", len(b))
+	}
+}
+
+func TestFramePoolAllocs(t *testing.T) {
+	frames := readVideoFrames(t)
+	if len(frames) < 3 {
+		t.Skip("not enough frames in", DecodeVideoName)
+	}
+	data, err := os.ReadFile(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := jxl.NewFramePool()
+	d, err := jxl.NewJxlDecoderFromBytes(data, &jxl.DecoderOptions{Pool: pool, Threads: jxl.ThreadsSingle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	b, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(b)
+	// One frame is left over for AllocsPerRun's warm-up call.
+	allocs := testing.AllocsPerRun(len(frames)-2, func() {
+		b, err := d.Read()
+		if b == nil {
+			t.Fatal("ran out of frames", err)
+		}
+		pool.Put(b)
+	})
+	if allocs != 0 {
+		t.Error("expected no allocations per pooled frame, got", allocs)
+	}
+}
+
+func TestFramePoolEnd(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := jxl.NewFramePool()
+	d, err := jxl.NewJxlDecoderFromBytes(data, &jxl.DecoderOptions{Pool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	b, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Put(b)
+	end, err := d.Read()
+	if end != nil || err != nil {
+		t.Fatal("expected end of image, got", err)
+	}
+	// The end of the image must not have taken the buffer from the pool.
+	if got := pool.Get(len(b)); &got[0] != &b[0] {
+		t.Error("the buffer was not left in the pool at the end of the image")
+	}
+}
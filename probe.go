@@ -0,0 +1,58 @@
+package gojxl
+
+import (
+	"io"
+	"time"
+)
+
+// #include <jxl/decode.h>
+import "C"
+
+const probeEvents = EventBasicInfo | EventColorEncoding | EventFrame | EventBox
+
+type ProbeResult struct {
+	Info      JxlInfo
+	Container bool
+	Frames    int
+	Durations []time.Duration
+	Duration  time.Duration
+	Boxes     []string
+}
+
+// Probe reads the headers of every frame without decoding any pixels.
+func Probe(r io.Reader) (ProbeResult, error) {
+	var res ProbeResult
+	d, err := NewDecoder(r, nil)
+	if err != nil {
+		return res, err
+	}
+	defer d.Destroy()
+	if err = d.Subscribe(probeEvents); err != nil {
+		return res, err
+	}
+	for {
+		ev, err := d.Next()
+		if err != nil {
+			return res, err
+		}
+		switch ev {
+		case EventSuccess:
+			return res, nil
+		case EventBasicInfo:
+			res.Info = d.BasicInfo()
+			res.Container = res.Info.Container
+		case EventBox:
+			res.Boxes = append(res.Boxes, d.BoxType(false))
+		case EventFrame:
+			d.frame = res.Frames
+			res.Frames++
+			res.Durations = append(res.Durations, d.lastFrameDur)
+			res.Duration += d.lastFrameDur
+		case EventNeedImageOutBuffer:
+			err = d.SkipCurrentFrame()
+			if err != nil {
+				return res, err
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+	"time"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestProbeVideo(t *testing.T) {
+	frames := readVideoFrames(t)
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := jxl.Probe(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Info.Animated {
+		t.Error("expected animated image")
+	}
+	if res.Frames != len(frames) {
+		t.Error("expected", len(frames), "frames, got", res.Frames)
+	}
+	for _, d := range res.Durations {
+		if d != 33*time.Millisecond {
+			t.Error("frame duration mismatch, expected 33 got", d)
+		}
+	}
+	if res.Duration != time.Duration(res.Frames)*33*time.Millisecond {
+		t.Error("total duration mismatch, got", res.Duration)
+	}
+}
+
+func TestProbeSingle(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := jxl.Probe(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Frames != 1 {
+		t.Error("expected 1 frame, got", res.Frames)
+	}
+	if res.Info.W == 0 || res.Info.H == 0 {
+		t.Error("missing basic info", res.Info)
+	}
+	t.Log(res.Container, res.Boxes)
+}
+
+func TestProbeContainer(t *testing.T) {
+	gain := image.NewGray(image.Rect(0, 0, 8, 8))
+	gm, err := jxl.NewGainMap(gain, &jxl.GainMapMetadata{AlternateHeadroom: 1, Gamma: [3]float64{1, 1, 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	err = jxl.EncodeWithOptions(buf, gain, &jxl.EncoderOptions{GainMap: gm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := jxl.Probe(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Container {
+		t.Error("expected a container")
+	}
+	if res.Frames != 1 {
+		t.Error("expected 1 frame, got", res.Frames)
+	}
+	found := false
+	for _, b := range res.Boxes {
+		found = found || b == "jhgm"
+	}
+	if !found {
+		t.Error("expected a jhgm box, got", res.Boxes)
+	}
+}
@@ -0,0 +1,37 @@
+package gojxl
+
+import "unsafe"
+
+// #include <jxl/resizable_parallel_runner.h>
+import "C"
+
+const (
+	ThreadsAuto   = 0
+	ThreadsSingle = -1
+)
+
+func newRunner(threads int) (unsafe.Pointer, bool) {
+	if threads == ThreadsSingle {
+		return nil, true
+	}
+	runner := C.JxlResizableParallelRunnerCreate(nil)
+	if runner == nil {
+		return nil, false
+	}
+	if threads > 0 {
+		C.JxlResizableParallelRunnerSetThreads(runner, C.size_t(threads))
+	}
+	return runner, true
+}
+
+func tuneRunner(runner unsafe.Pointer, threads int, x, y int) {
+	if runner != nil && threads == ThreadsAuto {
+		C.JxlResizableParallelRunnerSetThreads(runner, C.size_t(C.JxlResizableParallelRunnerSuggestThreads(C.uint64_t(x), C.uint64_t(y))))
+	}
+}
+
+func destroyRunner(runner unsafe.Pointer) {
+	if runner != nil {
+		C.JxlResizableParallelRunnerDestroy(runner)
+	}
+}
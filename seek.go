@@ -0,0 +1,128 @@
+package gojxl
+
+import (
+	"io"
+	"time"
+)
+
+// #include <jxl/decode.h>
+import "C"
+
+func (d *JxlDecoder) rewindInput() error {
+	if d.whole {
+		return d.Rewind()
+	}
+	s, ok := d.r.(io.Seeker)
+	if !ok {
+		return DecodeSeekError
+	}
+	_, err := s.Seek(d.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return d.Rewind()
+}
+
+func (d *JxlDecoder) skipCurrent() error {
+	for d.inFrame {
+		ev, err := d.Next()
+		if err != nil {
+			return err
+		}
+		switch ev {
+		case EventSuccess:
+			d.inFrame = false
+		case EventNeedImageOutBuffer:
+			err = d.SkipCurrentFrame()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SeekFrame positions the decoder so that the next Read returns frame n.
+// Seeking backwards rewinds the input, which must then be an io.Seeker
+// unless the decoder was created from bytes or an io.ReaderAt.
+func (d *JxlDecoder) SeekFrame(n int) error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	if n < d.firstFrame {
+		return DecodeSeekError
+	}
+	if n < d.frame {
+		err := d.rewindInput()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if n == d.frame {
+		return nil
+	}
+	err = d.skipCurrent()
+	if err != nil {
+		return err
+	}
+	if n > d.frame {
+		// JxlDecoderSkipFrames has no result, and past the last frame it
+		// quietly skips to the end of the image.
+		if d.header.is_last != C.JXL_FALSE {
+			return DecodeSeekError
+		}
+		C.JxlDecoderSkipFrames(d.decoder, C.size_t(n-d.frame))
+		d.frame = n
+	}
+	return nil
+}
+
+// SeekTime positions the decoder at the frame displayed at time t.
+// Frame durations that have not been seen yet are learned by scanning
+// forward without rendering the frames.
+func (d *JxlDecoder) SeekTime(t time.Duration) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if !info.Animated {
+		return d.SeekFrame(d.firstFrame)
+	}
+	if t < d.firstTime {
+		return DecodeSeekError
+	}
+	elapsed := d.firstTime
+	for i, dur := range d.durations {
+		elapsed += dur
+		if t < elapsed {
+			return d.SeekFrame(d.firstFrame + i)
+		}
+	}
+	err = d.SeekFrame(d.firstFrame + len(d.durations))
+	if err != nil {
+		return err
+	}
+	for !d.hitEnd {
+		ev, err := d.Next()
+		if err != nil {
+			return err
+		}
+		switch ev {
+		case EventFrame:
+			elapsed += d.lastFrameDur
+			if t < elapsed {
+				return nil
+			}
+		case EventNeedImageOutBuffer:
+			err = d.SkipCurrentFrame()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
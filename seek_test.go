@@ -0,0 +1,113 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func readVideoFrames(t *testing.T) [][]byte {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	var frames [][]byte
+	n, err := d.Read()
+	for n != nil {
+		frames = append(frames, n)
+		n, err = d.Read()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frames
+}
+
+func TestSeekFrame(t *testing.T) {
+	frames := readVideoFrames(t)
+	if len(frames) < 4 {
+		t.Skip("not enough frames in", DecodeVideoName)
+	}
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	for _, n := range []int{3, 1, len(frames) - 1, 0} {
+		err = d.SeekFrame(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := d.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, frames[n]) {
+			t.Error("frame mismatch after seeking to", n)
+		}
+	}
+	err = d.SeekFrame(len(frames) - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.SeekFrame(len(frames) + 1); err != jxl.DecodeSeekError {
+		t.Error("expected DecodeSeekError past the last frame, got", err)
+	}
+}
+
+func TestSeekTime(t *testing.T) {
+	frames := readVideoFrames(t)
+	if len(frames) < 4 {
+		t.Skip("not enough frames in", DecodeVideoName)
+	}
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	for _, n := range []int{2, 0, 3} {
+		err = d.SeekTime(time.Duration(n)*33*time.Millisecond + time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := d.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, frames[n]) {
+			t.Error("frame mismatch after seeking to frame", n)
+		}
+	}
+}
+
+func TestSeekNotSeekable(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(struct{ io.Reader }{f})
+	defer d.Destroy()
+	_, err = d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.SeekFrame(0)
+	if err != jxl.DecodeSeekError {
+		t.Error("expected DecodeSeekError, got", err)
+	}
+}
@@ -0,0 +1,75 @@
+package gojxl
+
+// #include <jxl/decode.h>
+import "C"
+
+// fill reads at least one byte into b. It does not wait for b to be full,
+// so a stream that pauses between images is not waited on.
+func (d *JxlDecoder) fill(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for {
+		n, err := d.r.Read(b)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (d *JxlDecoder) onEnd() {
+	d.hitEnd = true
+	d.left = int(C.JxlDecoderReleaseInput(d.decoder))
+}
+
+// Buffered returns the bytes that were read from the input after the end of
+// the image. It is only set once Read has returned nil, and is valid until
+// the next call on the decoder.
+func (d *JxlDecoder) Buffered() []byte {
+	if !d.hitEnd {
+		return nil
+	}
+	src := d.buf
+	if d.whole {
+		src = d.in
+	}
+	return src[d.inLen-d.left : d.inLen]
+}
+
+// InputOffset returns how many bytes of input the image has used so far.
+func (d *JxlDecoder) InputOffset() int64 {
+	return d.consumed - int64(len(d.Buffered()))
+}
+
+// ResetNext prepares the decoder for an image that directly follows the
+// current one in the same input, as in a stream of concatenated images.
+// Any bytes that were read past the end of the current image are kept.
+func (d *JxlDecoder) ResetNext() error {
+	if d.decoder == nil {
+		return DecodeClosedError
+	}
+	if !d.hitEnd {
+		return DecodeUnfinishedError
+	}
+	used := d.InputOffset()
+	left := d.left
+	C.JxlDecoderReset(d.decoder)
+	d.pinner.Unpin()
+	d.resetState()
+	if d.whole {
+		d.inPinner.Unpin()
+		d.in = d.in[d.inLen-left : d.inLen]
+		d.inLen = 0
+	} else {
+		copy(d.buf, d.buf[d.inLen-left:d.inLen])
+		d.inLen = left
+		d.pending = left
+		d.consumed = int64(left)
+	}
+	d.start += used
+	d.setup()
+	return nil
+}
@@ -0,0 +1,112 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+// trickleReader hands out at most n bytes per Read, like a slow socket.
+type trickleReader struct {
+	r io.Reader
+	n int
+}
+
+func (t *trickleReader) Read(b []byte) (int, error) {
+	if len(b) > t.n {
+		b = b[:t.n]
+	}
+	return t.r.Read(b)
+}
+
+func concatImages(t *testing.T) ([]byte, []int) {
+	var data []byte
+	var sizes []int
+	for _, name := range []string{DecodeSingleImgName, DecodeVideoName, DecodeSingleImgName} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+		sizes = append(sizes, len(b))
+	}
+	return data, sizes
+}
+
+func readConcatenated(t *testing.T, d *jxl.JxlDecoder, sizes []int) {
+	for i, size := range sizes {
+		if i != 0 {
+			err := d.ResetNext()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		frames := 0
+		for {
+			buf, err := d.Read()
+			if err != nil {
+				t.Fatalf("image %d: %v", i, err)
+			}
+			if buf == nil {
+				break
+			}
+			frames++
+		}
+		if frames == 0 {
+			t.Fatalf("image %d has no frames", i)
+		}
+		if d.InputOffset() != int64(size) {
+			t.Errorf("image %d: expected %d bytes used, got %d", i, size, d.InputOffset())
+		}
+	}
+	if len(d.Buffered()) != 0 {
+		t.Error("expected no bytes left over, got", len(d.Buffered()))
+	}
+	err := d.ResetNext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Info()
+	if !errors.Is(err, io.EOF) {
+		t.Error("expected io.EOF after the last image, got", err)
+	}
+}
+
+func TestConcatenatedStream(t *testing.T) {
+	data, sizes := concatImages(t)
+	d := jxl.NewJxlDecoder(&trickleReader{r: bytes.NewReader(data), n: 1000})
+	defer d.Destroy()
+	readConcatenated(t, d, sizes)
+}
+
+func TestConcatenatedBytes(t *testing.T) {
+	data, sizes := concatImages(t)
+	d, err := jxl.NewJxlDecoderFromBytes(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Destroy()
+	readConcatenated(t, d, sizes)
+}
+
+func TestResetNextUnfinished(t *testing.T) {
+	f, err := os.Open(DecodeVideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	_, err = d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.ResetNext()
+	if err != jxl.DecodeUnfinishedError {
+		t.Error("expected DecodeUnfinishedError, got", err)
+	}
+}
@@ -0,0 +1,154 @@
+package gojxl_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+
+	jxl "github.com/jlortiz0/go-jxl-decoder"
+)
+
+func TestDecodeAlign(t *testing.T) {
+	data, err := os.ReadFile(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := jxl.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jxl.DecodeWithOptions(bytes.NewReader(data), &jxl.DecoderOptions{Align: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := stride(got); s%64 != 0 || s < stride(want) {
+		t.Fatal("stride is not aligned:", s)
+	}
+	compareImages(t, got, want)
+}
+
+func TestReadImageSubImage(t *testing.T) {
+	f, err := os.Open(DecodeSingleImgName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := jxl.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+	r := want.Bounds()
+	big := newImageLike(want, image.Rect(0, 0, r.Dx()+13, r.Dy()+5))
+	sub := big.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(r.Add(image.Pt(13, 5)))
+	d := jxl.NewJxlDecoder(f)
+	defer d.Destroy()
+	_, err = d.ReadImage(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareImages(t, sub, want)
+}
+
+func TestEncodeStride(t *testing.T) {
+	const w, h, rowStride = 19, 11, 32
+	want := image.NewGray(image.Rect(0, 0, w, h))
+	raw := make([]byte, rowStride*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(pattern16(x, y, 0))
+			want.SetGray(x, y, color.Gray{v})
+			raw[y*rowStride+x] = v
+		}
+	}
+	buf := new(bytes.Buffer)
+	e, err := jxl.NewEncoder(buf, &jxl.EncoderOptions{Stride: rowStride, Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy()
+	if !e.SetInfo(w, h, color.GrayModel, 0) {
+		t.Fatal(e.Err())
+	}
+	err = e.Write(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jxl.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareImages(t, got, want)
+
+	padded := &image.Gray{Pix: raw, Stride: rowStride, Rect: want.Rect}
+	compareImages(t, roundTrip(t, padded, &jxl.EncoderOptions{Lossless: true}), want)
+}
+
+func TestEncodeStrideTooShort(t *testing.T) {
+	e, err := jxl.NewEncoder(io.Discard, &jxl.EncoderOptions{Stride: 4 * 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Destroy()
+	if e.SetInfo(16, 16, color.RGBAModel, 0) {
+		t.Error("expected SetInfo to refuse a stride shorter than a row")
+	}
+	if !errors.Is(e.Err(), jxl.EncodeInfoError) {
+		t.Error("expected EncodeInfoError, got", e.Err())
+	}
+}
+
+func pix(img image.Image) []byte {
+	p, _ := pixAndStride(img)
+	return p
+}
+
+func stride(img image.Image) int {
+	_, s := pixAndStride(img)
+	return s
+}
+
+func pixAndStride(img image.Image) ([]byte, int) {
+	switch i := img.(type) {
+	case *image.Gray:
+		return i.Pix, i.Stride
+	case *image.Gray16:
+		return i.Pix, i.Stride
+	case *image.RGBA:
+		return i.Pix, i.Stride
+	case *image.RGBA64:
+		return i.Pix, i.Stride
+	case *image.NRGBA:
+		return i.Pix, i.Stride
+	case *image.NRGBA64:
+		return i.Pix, i.Stride
+	}
+	return nil, 0
+}
+
+// compareImages checks that got and want hold the same pixels, whatever
+// their strides and origins.
+func compareImages(t *testing.T, got, want image.Image) {
+	t.Helper()
+	gr, wr := got.Bounds(), want.Bounds()
+	if gr.Size() != wr.Size() {
+		t.Fatal("size does not match", gr.Size(), wr.Size())
+	}
+	for y := 0; y < wr.Dy(); y++ {
+		for x := 0; x < wr.Dx(); x++ {
+			g := got.At(gr.Min.X+x, gr.Min.Y+y)
+			w := want.At(wr.Min.X+x, wr.Min.Y+y)
+			r1, g1, b1, a1 := g.RGBA()
+			r2, g2, b2, a2 := w.RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				t.Fatalf("pixel %d,%d differs: %v != %v", x, y, g, w)
+			}
+		}
+	}
+}